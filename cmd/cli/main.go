@@ -0,0 +1,256 @@
+package main
+
+import (
+	"MapPhotoMD/internal/config"
+	"MapPhotoMD/internal/model"
+	"MapPhotoMD/internal/service"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 退出码
+const (
+	exitOK      = 0 //生成成功
+	exitWarning = 1 //生成完成，但有照片或文件处理失败
+	exitUsage   = 2 //参数、任务文件或配置文件错误
+	exitFailed  = 3 //读取照片或坐标转换失败，未生成任何文件
+)
+
+// job 任务文件的内容，命令行参数会覆盖任务文件中的同名设置
+type job struct {
+	Name       string                   `json:"name"`       //旅行名称
+	Date       string                   `json:"date"`       //旅行日期
+	EndDate    string                   `json:"end_date"`   //旅行结束日期
+	Inputs     []*model.InputSourceData `json:"inputs"`     //照片来源
+	Output     string                   `json:"output"`     //导出路径
+	Properties []*model.PropertyData    `json:"properties"` //写入旅行记录的属性
+	Exports    []string                 `json:"exports"`    //额外导出的格式
+	Update     bool                     `json:"update"`     //旅行记录已存在时是否以更新模式生成
+}
+
+// listFlag 可重复指定的命令行参数
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+func main() {
+	os.Exit(run())
+}
+
+// run 解析参数并生成旅行记录，返回退出码
+func run() int {
+	var inputs, props, exports listFlag
+	configPath := flag.String("config", "config.json", "配置文件路径，与图形界面使用同一配置文件")
+	jobPath := flag.String("job", "", "任务文件路径（JSON），可包含旅行信息、照片来源和属性")
+	name := flag.String("name", "", "旅行名称")
+	date := flag.String("date", "", "旅行日期，格式为YYYY-MM-DD")
+	endDate := flag.String("end", "", "旅行结束日期，格式为YYYY-MM-DD，设置后只导入旅行期间拍摄的照片")
+	flag.Var(&inputs, "input", "照片所在文件夹，可重复指定")
+	output := flag.String("output", "", "旅行记录导出路径，即Ob库中存放旅行记录的文件夹")
+	flag.Var(&props, "prop", "写入旅行记录的属性，格式为 [类型:]名称=值，类型默认为文本，可重复指定")
+	flag.Var(&exports, "export", "额外导出的格式（"+strings.Join(service.ExportFormats, "、")+"），可重复指定")
+	update := flag.Bool("update", false, "旅行记录已存在时只添加新照片，保留手写的内容")
+	dryRun := flag.Bool("dry-run", false, "只显示生成计划，不写入任何文件")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "用法：mapphotomd-cli [参数]")
+		fmt.Fprintln(flag.CommandLine.Output(), "删除记录、生成记录、逆地理编码缓存和离线数据集等相对路径按配置文件所在目录解析")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cfg, err := config.LoadConfigFile(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "读取配置文件失败：", err)
+		return exitUsage
+	}
+	service.SetStateDir(filepath.Dir(*configPath)) //数据文件与配置文件放在同一目录，与图形界面共用
+
+	//读取任务文件，再用命令行参数覆盖
+	j := &job{}
+	if *jobPath != "" {
+		data, err := os.ReadFile(*jobPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "读取任务文件失败：", err)
+			return exitUsage
+		}
+		if err := json.Unmarshal(data, j); err != nil {
+			fmt.Fprintln(os.Stderr, "解析任务文件失败：", err)
+			return exitUsage
+		}
+	}
+	if err := j.applyFlags(*name, *date, *endDate, inputs, *output, props, exports, *update); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	//未指定的照片来源、导出路径、属性和导出格式使用配置文件中保存的设置
+	j.applyConfig(cfg)
+	if err := j.check(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	travelData := service.NewTravelData()
+	travelData.TravelName = j.Name
+	travelData.TravelDate = j.Date
+	travelData.TravelEndDate = j.EndDate
+	travelData.Inputs = j.Inputs
+	travelData.OutputPath = j.Output
+	travelData.Properties = j.Properties
+	travelData.Exports = j.Exports
+	travelData.Update = j.Update
+
+	plan, err := travelData.PlanMD(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailed
+	}
+	if *dryRun {
+		fmt.Print(plan.Summary())
+		return exitOK
+	}
+
+	report := travelData.Execute(plan, cfg)
+	fmt.Printf("已生成旅行记录：%s（%d张照片）\n", plan.BasePath, len(plan.ValidPhotos))
+	fmt.Print(report.Summary(cfg))
+	if len(report.CopyFailed) != 0 || len(report.DeleteFailed) != 0 || len(report.GeocodeFailed) != 0 || len(report.ExportErrors) != 0 {
+		return exitWarning
+	}
+	return exitOK
+}
+
+// applyFlags 用命令行参数覆盖任务文件中的设置，未指定的参数不覆盖
+func (j *job) applyFlags(name, date, endDate string, inputs listFlag, output string, props listFlag, exports listFlag, update bool) error {
+	if name != "" {
+		j.Name = name
+	}
+	if date != "" {
+		j.Date = date
+	}
+	if endDate != "" {
+		j.EndDate = endDate
+	}
+	if len(inputs) != 0 {
+		j.Inputs = nil
+		for _, path := range inputs {
+			j.Inputs = append(j.Inputs, &model.InputSourceData{Path: path})
+		}
+	}
+	if output != "" {
+		j.Output = output
+	}
+	if len(props) != 0 {
+		j.Properties = nil
+		for _, p := range props {
+			pro, err := parseProperty(p)
+			if err != nil {
+				return err
+			}
+			j.Properties = append(j.Properties, pro)
+		}
+	}
+	if len(exports) != 0 {
+		j.Exports = exports
+	}
+	if update {
+		j.Update = true
+	}
+	return nil
+}
+
+// applyConfig 未指定照片来源、导出路径、属性和导出格式时，使用配置文件中保存的设置
+func (j *job) applyConfig(cfg *config.UserConfig) {
+	if len(j.Inputs) == 0 {
+		j.Inputs = cfg.IOPath.Inputs
+	}
+	if j.Output == "" {
+		j.Output = cfg.IOPath.OutputPath
+	}
+	if j.Properties == nil {
+		j.Properties = cfg.Properties
+	}
+	if j.Exports == nil {
+		j.Exports = cfg.IOPath.Exports
+	}
+}
+
+// check 检查任务是否完整、格式是否正确，导出格式不区分大小写
+func (j *job) check() error {
+	if j.Name == "" {
+		return errors.New("未指定旅行名称")
+	}
+	start, err := time.Parse("2006-01-02", j.Date)
+	if err != nil {
+		return fmt.Errorf("旅行日期格式错误：%s", j.Date)
+	}
+	if j.EndDate != "" {
+		end, err := time.Parse("2006-01-02", j.EndDate)
+		if err != nil {
+			return fmt.Errorf("结束日期格式错误：%s", j.EndDate)
+		}
+		if end.Before(start) {
+			return fmt.Errorf("结束日期%s早于旅行日期%s", j.EndDate, j.Date)
+		}
+	}
+	if len(j.Inputs) == 0 {
+		return errors.New("未指定照片所在文件夹")
+	}
+	for _, src := range j.Inputs {
+		if _, err := os.Stat(src.Path); err != nil {
+			return fmt.Errorf("照片所在文件夹不存在：%s", src.Path)
+		}
+	}
+	if _, err := os.Stat(j.Output); j.Output == "" || err != nil {
+		return fmt.Errorf("导出路径不存在或未指定：%s", j.Output)
+	}
+	for i, e := range j.Exports {
+		found := false
+		for _, format := range service.ExportFormats {
+			if strings.EqualFold(e, format) {
+				j.Exports[i] = format
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("不支持的导出格式：%s", e)
+		}
+	}
+	return nil
+}
+
+// parseProperty 解析 [类型:]名称=值 格式的属性，类型默认为文本
+func parseProperty(s string) (*model.PropertyData, error) {
+	key, value, found := strings.Cut(s, "=")
+	if !found {
+		return nil, fmt.Errorf("属性格式错误，应为 [类型:]名称=值：%s", s)
+	}
+	pro := &model.PropertyData{Type: model.ProType_Text, Name: key, Value: value}
+	if proType, name, found := strings.Cut(key, ":"); found {
+		valid := false
+		for _, t := range model.ProTypes {
+			if t == proType {
+				valid = true
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("属性类型错误，可选的类型为%s：%s", strings.Join(model.ProTypes, "、"), s)
+		}
+		pro.Type, pro.Name = proType, name
+	}
+	if pro.Name == "" {
+		return nil, fmt.Errorf("属性名称为空：%s", s)
+	}
+	return pro, nil
+}
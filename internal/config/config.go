@@ -1,41 +1,126 @@
 package config
 
 import (
-	"MapPhotoMD/mywidget"
+	"MapPhotoMD/internal/model"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 
 	"fyne.io/fyne/v2"
 )
 
+// 可选的逆地理编码方式
+const (
+	Geocoder_None    = ""        //不进行逆地理编码
+	Geocoder_Amap    = "amap"    //高德在线逆地理编码
+	Geocoder_Offline = "offline" //基于本地数据集的离线逆地理编码
+)
+
+// 转存照片中GPS信息的处理方式
+const (
+	PhotoGPS_Keep    = ""        //保留
+	PhotoGPS_Strip   = "strip"   //删除
+	PhotoGPS_Coarsen = "coarsen" //模糊到指定精度
+)
+
+// 照片位于隐私区域内时的处理方式
+const (
+	Geofence_Exclude    = "exclude" //排除照片，不生成标记点、不转存
+	Geofence_HideMarker = "hide"    //只隐藏标记点，照片仍会转存
+)
+
+// 删除原照片的方式，两种方式都可以恢复
+const (
+	DeleteTo_Folder = "folder" //移到暂存目录
+	DeleteTo_Trash  = "trash"  //移到系统回收站，目前只支持Linux，其他系统仍移到暂存目录
+)
+
+// Geofence 隐私区域，以圆心和半径表示。圆心使用高德坐标（GCJ-02），可直接从高德地图上拾取
+type Geofence struct {
+	Name   string  `json:"name"`   //区域名称
+	Lat    float64 `json:"lat"`    //圆心纬度
+	Long   float64 `json:"long"`   //圆心经度
+	Radius float64 `json:"radius"` //半径，单位米
+}
+
+// DefaultAmapBaseURL 高德开放平台接口的默认地址
+const DefaultAmapBaseURL = "https://restapi.amap.com"
+
 type IOPath struct {
-	InputPath  string `json:"input_path"`  //导入路径
-	OutputPath string `json:"output_path"` //导出路径
+	InputPath  string                   `json:"input_path,omitempty"` //旧版本的导入路径，读取配置时转换为Inputs
+	Inputs     []*model.InputSourceData `json:"inputs"`               //照片来源
+	OutputPath string                   `json:"output_path"`          //导出路径
+	Exports    []string                 `json:"exports"`              //额外导出的格式
 }
 
 // UserConfig 用户配置数据
 type UserConfig struct {
-	Key            string                   `json:"key"`             //高德key
-	NotePath       string                   `json:"note_path"`       //ob库路径
-	SaveIOPath     bool                     `json:"save_io_path"`    //是否保存导入导出路径
-	IOPath         IOPath                   `json:"io_path"`         //导入导出路径
-	MovePhoto      bool                     `json:"move_photo"`      //是否转存照片
-	PhotoPath      string                   `json:"photo_path"`      //转存路径
-	DeletePhoto    bool                     `json:"delete_Photo"`    //是否删除原照片
-	PhotoQuality   int                      `json:"photo_quality"`   //照片质量
-	SaveProperties bool                     `json:"save_properties"` //是否保存YAML属性
-	Properties     []*mywidget.PropertyData `json:"properties"`      //旅行记录YAML属性
+	Key            string                `json:"key"`             //高德key
+	NotePath       string                `json:"note_path"`       //ob库路径
+	SaveIOPath     bool                  `json:"save_io_path"`    //是否保存导入导出路径
+	IOPath         IOPath                `json:"io_path"`         //导入导出路径
+	ScanDepth      int                   `json:"scan_depth"`      //读取子文件夹的层数，0为只读取导入目录，-1为不限制
+	SkipHidden     bool                  `json:"skip_hidden"`     //是否跳过以.开头的隐藏文件和文件夹
+	IncludeGlobs   []string              `json:"include_globs"`   //只读取匹配的照片，为空时读取全部
+	ExcludeGlobs   []string              `json:"exclude_globs"`   //跳过匹配的照片和文件夹
+	MovePhoto      bool                  `json:"move_photo"`      //是否转存照片
+	PhotoPath      string                `json:"photo_path"`      //转存路径
+	MirrorFolders  bool                  `json:"mirror_folders"`  //转存时是否保留照片在导入目录中的子文件夹结构
+	DeletePhoto    bool                  `json:"delete_Photo"`    //是否删除原照片
+	DeleteTo       string                `json:"delete_to"`       //删除原照片的方式
+	DeletedPath    string                `json:"deleted_path"`    //原照片暂存目录
+	PhotoQuality   int                   `json:"photo_quality"`   //照片质量
+	PhotoMaxEdge   int                   `json:"photo_max_edge"`  //转存照片的最大长边像素，0为不限制
+	KeepEXIF       bool                  `json:"keep_exif"`       //压缩照片时是否保留EXIF信息
+	RenamePhoto    bool                  `json:"rename_photo"`    //是否按模板重命名转存的照片
+	PhotoName      string                `json:"photo_name"`      //转存照片命名模板
+	PhotoGPS       string                `json:"photo_gps"`       //转存照片中GPS信息的处理方式
+	GPSPrecision   int                   `json:"gps_precision"`   //模糊GPS时保留的小数位数
+	CoarsenMarkers bool                  `json:"coarsen_markers"` //是否模糊标记点、路线和额外导出中的坐标
+	Geofences      []Geofence            `json:"geofences"`       //隐私区域
+	GeofenceMode   string                `json:"geofence_mode"`   //照片位于隐私区域内时的处理方式
+	SaveProperties bool                  `json:"save_properties"` //是否保存YAML属性
+	Properties     []*model.PropertyData `json:"properties"`      //旅行记录YAML属性
+	MarkerName     string                `json:"marker_name"`     //标记点文件命名模板
+	DrawRoute      bool                  `json:"draw_route"`      //是否生成旅行路线
+	RouteColor     string                `json:"route_color"`     //路线颜色
+	SplitRouteDay  bool                  `json:"split_route_day"` //是否按天拆分路线
+	Geocoder       string                `json:"geocoder"`        //逆地理编码方式
+	AmapBaseURL    string                `json:"amap_base_url"`   //高德接口地址
+	GeoDataPath    string                `json:"geo_data_path"`   //离线逆地理编码数据集路径
+	MakeThumbnail  bool                  `json:"make_thumbnail"`  //是否生成缩略图
+	ThumbnailSize  int                   `json:"thumbnail_size"`  //缩略图最大长边像素
 }
 
 // NewUserConfig 创建用户配置结构体
 func NewUserConfig() *UserConfig {
 	return &UserConfig{
 		SaveIOPath:     true,
+		ScanDepth:      -1,
+		SkipHidden:     true,
 		MovePhoto:      false,
+		MirrorFolders:  false,
 		DeletePhoto:    false,
+		DeleteTo:       DeleteTo_Folder,
 		PhotoQuality:   100,
+		PhotoMaxEdge:   0,
+		KeepEXIF:       true,
+		RenamePhoto:    false,
+		PhotoName:      "{date}_{time}_{trip}_{seq}",
+		PhotoGPS:       PhotoGPS_Keep,
+		GPSPrecision:   2,
+		CoarsenMarkers: false,
+		GeofenceMode:   Geofence_Exclude,
 		SaveProperties: true,
+		MarkerName:     "{name}",
+		DrawRoute:      false,
+		RouteColor:     "#3388ff",
+		SplitRouteDay:  false,
+		Geocoder:       Geocoder_None,
+		AmapBaseURL:    DefaultAmapBaseURL,
+		MakeThumbnail:  false,
+		ThumbnailSize:  320,
 	}
 }
 
@@ -77,6 +162,30 @@ func (config *UserConfig) ReadConfigFile(ap fyne.App) {
 		})
 		return
 	}
+	config.migrate()
+}
+
+// LoadConfigFile 读取指定路径的配置文件，不依赖图形界面，可用于命令行。配置文件中没有的设置项使用默认值
+func LoadConfigFile(path string) (*UserConfig, error) {
+	config := NewUserConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败：%v", err)
+	}
+	config.migrate()
+	return config, nil
+}
+
+// migrate 将旧版本的配置转换为当前格式
+func (config *UserConfig) migrate() {
+	//旧版本只有一个导入路径
+	if len(config.IOPath.Inputs) == 0 && config.IOPath.InputPath != "" {
+		config.IOPath.Inputs = []*model.InputSourceData{{Path: config.IOPath.InputPath}}
+	}
+	config.IOPath.InputPath = ""
 }
 
 // SaveConfigFile 保存配置到config.json
@@ -0,0 +1,8 @@
+package model
+
+// InputSourceData 一个照片来源
+type InputSourceData struct {
+	Path        string `json:"path"`         //照片文件夹
+	Label       string `json:"label"`        //来源标签，如“手机”“相机”，写入标记点，可为空
+	ClockOffset string `json:"clock_offset"` //相机时钟偏差，照片拍摄时间加上此值为实际时间，如 -1h、+8h30m，可为空
+}
@@ -0,0 +1,32 @@
+package model
+
+// 内置的属性类型
+const (
+	ProType_Tag     = "标签"
+	ProType_Aliases = "别名"
+	ProType_css     = "样式"
+	ProType_Text    = "文本"
+	ProType_List    = "列表"
+	ProType_Num     = "数字"
+	ProType_Check   = "复选框"
+	ProType_Date    = "日期"
+)
+
+// ProTypes 所有内置的属性类型
+var ProTypes = []string{
+	ProType_Tag,
+	ProType_Aliases,
+	ProType_css,
+	ProType_Text,
+	ProType_List,
+	ProType_Num,
+	ProType_Check,
+	ProType_Date,
+}
+
+// PropertyData 写入旅行记录的一条属性
+type PropertyData struct {
+	Type  string `json:"type"`  //属性类型
+	Name  string `json:"name"`  //属性名称
+	Value string `json:"value"` //属性值
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"encoding/csv"
+	"path/filepath"
+	"strconv"
+)
+
+// 元数据表格的表头
+var metadataHeader = []string{
+	"文件名", "路径", "状态", "原因", "拍摄时间", "拍摄设备",
+	"WGS-84纬度", "WGS-84经度", "高德纬度", "高德经度", "标记点文件",
+}
+
+// 元数据表格中的数字列
+var metadataNumCols = map[int]bool{6: true, 7: true, 8: true, 9: true}
+
+// metadataRows 将本次扫描到的所有照片整理为表格行，依次为有效照片、更新模式下已有的标记点、
+// 不在旅行日期内或位于隐私区域内被移除的照片和无法转换的照片
+func (t *TravelData) metadataRows(basePath string, points []exportPoint) [][]string {
+	formatFloat := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', 6, 64)
+	}
+	var rows [][]string
+	for _, p := range points {
+		status := "有效"
+		if p.existing {
+			status = "已有"
+		}
+		rows = append(rows, []string{
+			p.name,
+			p.path,
+			status,
+			"",
+			p.date,
+			p.device,
+			formatFloat(p.raw.lat),
+			formatFloat(p.raw.long),
+			formatFloat(p.converted.lat),
+			formatFloat(p.converted.long),
+			filepath.Join(basePath, "markers", p.marker+".md"),
+		})
+	}
+	for _, f := range pData.filtered {
+		lat, long := "", ""
+		if f.raw != nil {
+			lat, long = formatFloat(f.raw.lat), formatFloat(f.raw.long)
+		}
+		rows = append(rows, []string{
+			f.name,
+			t.sourcePath(f.source, f.name),
+			f.status,
+			f.reason,
+			f.date,
+			f.device,
+			lat, long, "", "", "",
+		})
+	}
+	for i := range pData.invalidPhotos {
+		rows = append(rows, []string{
+			pData.invalidPhotos[i],
+			pData.invalidPaths[i],
+			"无效",
+			pData.invalidReasons[i],
+			"", "", "", "", "", "", "",
+		})
+	}
+	return rows
+}
+
+// exportCSV 导出所有扫描到的照片的元数据CSV表格
+func (t *TravelData) exportCSV(basePath string, points []exportPoint) error {
+	file, err := createFile(filepath.Join(basePath, t.TravelName+".csv"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	//写入UTF-8 BOM，否则Excel打开时中文会乱码
+	if _, err := file.WriteString("\uFEFF"); err != nil {
+		return err
+	}
+	w := csv.NewWriter(file)
+	w.Write(metadataHeader)
+	w.WriteAll(t.metadataRows(basePath, points))
+	return w.Error()
+}
+
+// exportXLSX 导出所有扫描到的照片的元数据XLSX表格
+func (t *TravelData) exportXLSX(basePath string, points []exportPoint) error {
+	return writeXLSX(filepath.Join(basePath, t.TravelName+".xlsx"), metadataHeader, t.metadataRows(basePath, points), metadataNumCols)
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"MapPhotoMD/internal/model"
+	"archive/zip"
+	"encoding/csv"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestXlsxColumn(t *testing.T) {
+	tests := []struct {
+		col  int
+		want string
+	}{
+		{0, "A"}, {25, "Z"}, {26, "AA"}, {51, "AZ"}, {52, "BA"}, {701, "ZZ"}, {702, "AAA"},
+	}
+	for _, tt := range tests {
+		if got := xlsxColumn(tt.col); got != tt.want {
+			t.Errorf("xlsxColumn(%d) = %s，应为%s", tt.col, got, tt.want)
+		}
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	setPhotos([]string{"a.jpg", "b.jpg"}, []string{"2024-05-01 10:00:00", ""})
+	assignMarkerNames("{name}", nil)
+	addInvalidPhoto("c.jpg", "/in/c.jpg", "没有经纬度信息")
+	td := &TravelData{TravelName: "trip", Inputs: []*model.InputSourceData{{Path: "/in"}}}
+
+	dir := t.TempDir()
+	if err := td.exportCSV(dir, td.exportPoints(dir, &config.UserConfig{})); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "trip.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "\uFEFF") {
+		t.Errorf("CSV应以UTF-8 BOM开头")
+	}
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(string(data), "\uFEFF"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//表头加上每张扫描到的照片各一行，有效照片在前
+	if len(records) != 4 || records[0][0] != "文件名" {
+		t.Fatalf("CSV有%d行：%v", len(records), records)
+	}
+	if records[1][0] != "a.jpg" || records[1][2] != "有效" || records[1][6] != "39.900000" || records[1][10] != filepath.Join(dir, "markers", "a.md") {
+		t.Errorf("有效照片行错误：%v", records[1])
+	}
+	if records[3][0] != "c.jpg" || records[3][2] != "无效" || records[3][3] != "没有经纬度信息" || records[3][6] != "" {
+		t.Errorf("无效照片行错误：%v", records[3])
+	}
+}
+
+func TestExportXLSX(t *testing.T) {
+	setPhotos([]string{"a&b.jpg"}, []string{"2024-05-01 10:00:00"})
+	assignMarkerNames("{name}", nil)
+	td := &TravelData{TravelName: "trip", Inputs: []*model.InputSourceData{{Path: "/in"}}}
+
+	dir := t.TempDir()
+	if err := td.exportXLSX(dir, td.exportPoints(dir, &config.UserConfig{})); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.OpenReader(filepath.Join(dir, "trip.xlsx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	var sheet string
+	for _, f := range zr.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, _ := f.Open()
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			sheet = string(data)
+		}
+	}
+	if len(zr.File) != len(xlsxStaticParts)+1 || sheet == "" {
+		t.Fatalf("XLSX部件不完整")
+	}
+	if strings.Count(sheet, "<row ") != 2 {
+		t.Errorf("工作表应有表头和1行数据：%s", sheet)
+	}
+	//文本转义，坐标列写为数字
+	if !strings.Contains(sheet, "a&amp;b.jpg") || !strings.Contains(sheet, `<c r="G2"><v>39.900000</v></c>`) {
+		t.Errorf("单元格内容错误：%s", sheet)
+	}
+}
+
+func TestMetadataRowsCoverAllScannedPhotos(t *testing.T) {
+	dir := chdirTemp(t)
+	in := filepath.Join(dir, "in")
+	writeJPEG(t, in, "a.jpg", testPhoto{date: "2024:05:01 10:00:00", lat: 39.95, long: 116.45})
+	writeJPEG(t, in, "early.jpg", testPhoto{date: "2024:04:20 10:00:00", lat: 39.95, long: 116.45})
+	writeJPEG(t, in, "home.jpg", testPhoto{date: "2024:05:01 11:00:00", lat: 39.90734, long: 116.39089})
+	writeTestJPEG(t, in, "nogps.jpg")
+	scanned := 4
+
+	tests := []struct {
+		name       string
+		mode       string
+		wantStatus string
+	}{
+		{"排除隐私区域内的照片", config.Geofence_Exclude, "排除"},
+		{"隐藏隐私区域内照片的标记点", config.Geofence_HideMarker, "隐藏标记点"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.NewUserConfig()
+			cfg.AmapBaseURL = newConvertServer(t).URL
+			cfg.MovePhoto = false
+			cfg.Geofences = []config.Geofence{{Name: "家", Lat: 39.90875, Long: 116.39723, Radius: 500}}
+			cfg.GeofenceMode = tt.mode
+			td := &TravelData{TravelName: "trip", TravelDate: "2024-05-01", TravelEndDate: "2024-05-03",
+				Inputs: []*model.InputSourceData{{Path: in}}, OutputPath: filepath.Join(dir, tt.mode), Exports: []string{Export_CSV, Export_XLSX}}
+			planAndExecute(t, td, cfg)
+			base := filepath.Join(td.OutputPath, "trip")
+
+			records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(readText(filepath.Join(base, "trip.csv")), "\uFEFF"))).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			//表头加上每个扫描到的文件各一行
+			if len(records) != scanned+1 {
+				t.Fatalf("CSV有%d行，应为%d行：%v", len(records), scanned+1, records)
+			}
+			rows := make(map[string][]string)
+			for _, r := range records[1:] {
+				rows[r[0]] = r
+			}
+			if r := rows["early.jpg"]; r[2] != "排除" || r[3] != "不在旅行日期内" || r[6] == "" {
+				t.Errorf("不在旅行日期内的照片行错误：%v", r)
+			}
+			//隐私区域内的照片不写入坐标
+			if r := rows["home.jpg"]; r[2] != tt.wantStatus || r[3] != "位于隐私区域内" || strings.Join(r[6:], "") != "" {
+				t.Errorf("隐私区域内的照片行错误：%v", r)
+			}
+			if rows["a.jpg"][2] != "有效" || rows["nogps.jpg"][2] != "无效" {
+				t.Errorf("有效或无效照片行错误：%v", records)
+			}
+
+			zr, err := zip.OpenReader(filepath.Join(base, "trip.xlsx"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer zr.Close()
+			for _, f := range zr.File {
+				if f.Name != "xl/worksheets/sheet1.xml" {
+					continue
+				}
+				rc, _ := f.Open()
+				data, _ := io.ReadAll(rc)
+				rc.Close()
+				if n := strings.Count(string(data), "<row "); n != scanned+1 {
+					t.Errorf("XLSX有%d行，应为%d行", n, scanned+1)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"fmt"
+	"time"
+)
+
+// filterDateRange 将拍摄时间不在旅行日期内的照片从有效照片中移除，返回被移除的照片及其拍摄时间。
+// 未设置结束日期时不筛选；没有拍摄时间的照片无法判断是否在旅行日期内，予以保留
+func (t *TravelData) filterDateRange() ([]string, error) {
+	if t.TravelEndDate == "" {
+		return nil, nil
+	}
+	start, err := time.ParseInLocation("2006-01-02", t.TravelDate, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("旅行日期格式错误：%s", t.TravelDate)
+	}
+	end, err := time.ParseInLocation("2006-01-02", t.TravelEndDate, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("结束日期格式错误：%s", t.TravelEndDate)
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("结束日期%s早于旅行日期%s", t.TravelEndDate, t.TravelDate)
+	}
+	//包含结束日期当天
+	end = end.AddDate(0, 0, 1)
+
+	var removed []string
+	keep := make([]bool, len(pData.validPhotos))
+	for i, name := range pData.validPhotos {
+		taken, ok := photoTime(i)
+		if !ok || (!taken.Before(start) && taken.Before(end)) {
+			keep[i] = true
+			continue
+		}
+		removed = append(removed, fmt.Sprintf("%s（%s）", name, taken.Format("2006-01-02 15:04")))
+		addFilteredPhoto(i, "排除", "不在旅行日期内", true)
+	}
+	keepPhotos(keep)
+	return removed, nil
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFilterDateRange(t *testing.T) {
+	//照片的EXIF拍摄时间，没有时为空
+	photos := map[string]string{
+		"first.jpg":  "2024:05:01 00:30:00",
+		"middle.jpg": "2024:05:02 12:00:00",
+		"last.jpg":   "2024:05:03 23:30:00",
+		"before.jpg": "2024:04:30 23:59:59",
+		"nodate.jpg": "",
+	}
+	order := []string{"before.jpg", "first.jpg", "last.jpg", "middle.jpg", "nodate.jpg"}
+	tests := []struct {
+		name       string
+		start, end string
+		offset     string
+		wantKept   []string
+		wantDates  []string
+		wantRemove []string
+		wantErr    bool
+	}{
+		{
+			name:      "未设置结束日期时不筛选",
+			start:     "2024-05-01",
+			wantKept:  order,
+			wantDates: []string{"2024-04-30 23:59:59", "2024-05-01 00:30:00", "2024-05-03 23:30:00", "2024-05-02 12:00:00", ""},
+		},
+		{
+			name:       "包含起止日期当天，保留没有拍摄时间的照片",
+			start:      "2024-05-01",
+			end:        "2024-05-03",
+			wantKept:   []string{"first.jpg", "last.jpg", "middle.jpg", "nodate.jpg"},
+			wantDates:  []string{"2024-05-01 00:30:00", "2024-05-03 23:30:00", "2024-05-02 12:00:00", ""},
+			wantRemove: []string{"before.jpg（2024-04-30 23:59）"},
+		},
+		{
+			name:       "时钟偏快时校正后的时间移出旅行日期",
+			start:      "2024-05-01",
+			end:        "2024-05-03",
+			offset:     "-1h",
+			wantKept:   []string{"last.jpg", "middle.jpg", "nodate.jpg"},
+			wantDates:  []string{"2024-05-03 22:30:00", "2024-05-02 11:00:00", ""},
+			wantRemove: []string{"before.jpg（2024-04-30 22:59）", "first.jpg（2024-04-30 23:30）"},
+		},
+		{
+			name:       "时钟偏慢时校正后的时间移入、移出旅行日期",
+			start:      "2024-05-01",
+			end:        "2024-05-03",
+			offset:     "+1h",
+			wantKept:   []string{"before.jpg", "first.jpg", "middle.jpg", "nodate.jpg"},
+			wantDates:  []string{"2024-05-01 00:59:59", "2024-05-01 01:30:00", "2024-05-02 13:00:00", ""},
+			wantRemove: []string{"last.jpg（2024-05-04 00:30）"},
+		},
+		{
+			name:      "结束日期早于旅行日期",
+			start:     "2024-05-03",
+			end:       "2024-05-01",
+			wantKept:  order,
+			wantDates: []string{"2024-04-30 23:59:59", "2024-05-01 00:30:00", "2024-05-03 23:30:00", "2024-05-02 12:00:00", ""},
+			wantErr:   true,
+		},
+		{
+			name:      "日期格式错误",
+			start:     "2024/05/01",
+			end:       "2024-05-03",
+			wantKept:  order,
+			wantDates: []string{"2024-04-30 23:59:59", "2024-05-01 00:30:00", "2024-05-03 23:30:00", "2024-05-02 12:00:00", ""},
+			wantErr:   true,
+		},
+	}
+
+	dir := t.TempDir()
+	for name, date := range photos {
+		writeJPEG(t, dir, name, testPhoto{date: date, lat: 39.9, long: 116.3})
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pData = photoData{}
+			offset, err := parseClockOffset(tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range order {
+				readPhoto(name, filepath.Join(dir, name), 0, offset)
+			}
+			td := &TravelData{TravelDate: tt.start, TravelEndDate: tt.end}
+			removed, err := td.filterDateRange()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("错误为%v，是否应出错%v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(pData.validPhotos, tt.wantKept) {
+				t.Errorf("保留的照片为%v，应为%v", pData.validPhotos, tt.wantKept)
+			}
+			if !reflect.DeepEqual(pData.date, tt.wantDates) {
+				t.Errorf("拍摄时间为%v，应为%v", pData.date, tt.wantDates)
+			}
+			if !reflect.DeepEqual(removed, tt.wantRemove) {
+				t.Errorf("移除的照片为%v，应为%v", removed, tt.wantRemove)
+			}
+			//各切片应保持一一对应
+			if len(pData.rawLocation) != len(pData.validPhotos) || len(pData.source) != len(pData.validPhotos) {
+				t.Errorf("筛选后切片长度不一致")
+			}
+		})
+	}
+}
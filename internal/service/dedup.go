@@ -0,0 +1,79 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// copyIndex 转存目录中文件内容的索引，用于跳过与已有文件内容相同的照片。
+// 先按文件大小分组，只有大小相同时才读取文件计算哈希，避免读取整个目录
+type copyIndex struct {
+	dir     string
+	pending map[int64][]string //尚未计算哈希的文件，按大小分组
+	byHash  map[string]string  //文件内容的SHA-256到文件名的映射
+}
+
+// newCopyIndex 为转存目录及其子文件夹创建内容索引，文件以/分隔的相对路径表示。
+// 跳过以.开头的隐藏文件夹，目录不存在时索引为空
+func newCopyIndex(dir string) *copyIndex {
+	c := &copyIndex{
+		dir:     dir,
+		pending: make(map[int64][]string),
+		byHash:  make(map[string]string),
+	}
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if p != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return nil
+		}
+		c.pending[info.Size()] = append(c.pending[info.Size()], filepath.ToSlash(rel))
+		return nil
+	})
+	return c
+}
+
+// contentHash 计算数据的SHA-256
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// find 查找转存目录中与data内容相同的文件，找到时返回其相对路径
+func (c *copyIndex) find(data []byte) (string, bool) {
+	//先计算大小相同的文件的哈希
+	size := int64(len(data))
+	for _, name := range c.pending[size] {
+		if existing, err := os.ReadFile(filepath.Join(c.dir, filepath.FromSlash(name))); err == nil {
+			c.add(name, existing)
+		}
+	}
+	delete(c.pending, size)
+
+	name, ok := c.byHash[contentHash(data)]
+	return name, ok
+}
+
+// add 将新转存的文件加入索引
+func (c *copyIndex) add(name string, data []byte) {
+	hash := contentHash(data)
+	if _, ok := c.byHash[hash]; !ok {
+		c.byHash[hash] = name
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"MapPhotoMD/internal/model"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCopyIndex(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"a.jpg": "aaaa", "b.jpg": "bb", "c.jpg": "cccc"} {
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	index := newCopyIndex(dir)
+
+	tests := []struct {
+		name   string
+		data   string
+		want   string
+		wantOK bool
+	}{
+		{"内容相同", "cccc", "c.jpg", true},
+		{"大小相同但内容不同", "dddd", "", false},
+		{"大小不同", "bb", "b.jpg", true},
+		{"没有相同大小的文件", "eeeeee", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := index.find([]byte(tt.data))
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("%s：得到%q %v，应为%q %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	//新转存的文件加入索引后可以找到，内容相同时保留先加入的文件名
+	index.add("new.jpg", []byte("eeeeee"))
+	index.add("new_2.jpg", []byte("eeeeee"))
+	if got, _ := index.find([]byte("eeeeee")); got != "new.jpg" {
+		t.Errorf("得到%q，应为new.jpg", got)
+	}
+
+	//目录不存在时索引为空
+	if _, ok := newCopyIndex(filepath.Join(dir, "missing")).find([]byte("aaaa")); ok {
+		t.Errorf("目录不存在时不应找到文件")
+	}
+}
+
+func TestMovePhotoDeduplicates(t *testing.T) {
+	in := t.TempDir()
+	out := t.TempDir()
+	writeTestJPEG(t, in, "a.jpg")
+	writeTestJPEG(t, in, "b.jpg")
+	writeTestJPEG(t, out, "old.jpg")
+	setPhotos([]string{"a.jpg", "b.jpg"}, []string{"", ""})
+	cfg := &config.UserConfig{MovePhoto: true, PhotoPath: out, PhotoQuality: 100, PhotoGPS: config.PhotoGPS_Keep}
+	td := &TravelData{Inputs: []*model.InputSourceData{{Path: in}}}
+	td.assignCopyNames(out, cfg)
+
+	//两张照片都与转存目录中已有的照片内容相同
+	n, verified, failed := td.movePhoto(t.TempDir(), cfg)
+	if n != 2 || len(failed) != 0 {
+		t.Errorf("去重%d张，应为2张：%v", n, failed)
+	}
+	//引用已有文件的照片也通过校验，可以删除原照片
+	if len(verified) != 2 {
+		t.Errorf("通过校验的照片为%v", verified)
+	}
+	if !reflect.DeepEqual(pData.copyNames, []string{"old.jpg", "old.jpg"}) {
+		t.Errorf("转存文件名为%v", pData.copyNames)
+	}
+	entries, _ := os.ReadDir(out)
+	if len(entries) != 1 {
+		t.Errorf("转存目录中有%d个文件，不应重复保存", len(entries))
+	}
+}
@@ -0,0 +1,267 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// EXIF中用到的标签
+const (
+	tagOrientation     = 0x0112 //方向
+	tagExifIFD         = 0x8769 //Exif子IFD指针
+	tagGPSIFD          = 0x8825 //GPS子IFD指针
+	tagPixelXDimension = 0xA002 //图像宽度
+	tagPixelYDimension = 0xA003 //图像高度
+)
+
+// GPS子IFD中需要模糊处理的坐标标签：纬度、经度、目标纬度、目标经度
+var gpsCoordTags = []uint16{0x0002, 0x0004, 0x0014, 0x0016}
+
+// TIFF数据类型
+const (
+	tiffShort    = 3
+	tiffLong     = 4
+	tiffRational = 5
+)
+
+// TIFF各数据类型每个值占用的字节数，下标为类型编号
+var tiffTypeSize = []int{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8}
+
+// exifHeader APP1段中EXIF数据的标识
+var exifHeader = []byte("Exif\x00\x00")
+
+// exifSegmentPos 找出JPEG数据中EXIF所在的APP1段（含标记和长度）的起止位置，没有时ok为false
+func exifSegmentPos(jpegData []byte) (start int, end int, ok bool) {
+	if len(jpegData) < 4 || jpegData[0] != 0xFF || jpegData[1] != 0xD8 {
+		return 0, 0, false
+	}
+	for pos := 2; pos+4 <= len(jpegData); {
+		if jpegData[pos] != 0xFF {
+			return 0, 0, false
+		}
+		marker := jpegData[pos+1]
+		//图像数据开始，之后不会再有APP段
+		if marker == 0xDA || marker == 0xD9 {
+			return 0, 0, false
+		}
+		length := int(binary.BigEndian.Uint16(jpegData[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(jpegData) {
+			return 0, 0, false
+		}
+		if marker == 0xE1 && bytes.HasPrefix(jpegData[pos+4:end], exifHeader) {
+			return pos, end, true
+		}
+		pos = end
+	}
+	return 0, 0, false
+}
+
+// exifSegment 从JPEG数据中找出EXIF所在的APP1段（含标记和长度），没有时返回nil。返回的是副本，可以直接修改
+func exifSegment(jpegData []byte) []byte {
+	start, end, ok := exifSegmentPos(jpegData)
+	if !ok {
+		return nil
+	}
+	return append([]byte(nil), jpegData[start:end]...)
+}
+
+// insertExifSegment 将APP1段插入到JPEG数据的SOI标记之后
+func insertExifSegment(jpegData []byte, seg []byte) []byte {
+	if len(seg) == 0 || len(jpegData) < 2 {
+		return jpegData
+	}
+	out := make([]byte, 0, len(jpegData)+len(seg))
+	out = append(out, jpegData[:2]...)
+	out = append(out, seg...)
+	return append(out, jpegData[2:]...)
+}
+
+// ifdEntry IFD中的一个条目
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	pos   int //条目在TIFF数据中的位置
+}
+
+// exifEditor 原地修改APP1段中的EXIF数据，不改变数据长度和布局
+type exifEditor struct {
+	tiff  []byte           //APP1段中的TIFF数据，与APP1段共享内存
+	order binary.ByteOrder //字节序
+}
+
+// newExifEditor 解析APP1段，返回可以原地修改其内容的编辑器
+func newExifEditor(seg []byte) (*exifEditor, error) {
+	start := 4 + len(exifHeader)
+	if len(seg) < start+8 {
+		return nil, errors.New("EXIF数据过短")
+	}
+	x := &exifEditor{tiff: seg[start:]}
+	switch string(x.tiff[:2]) {
+	case "II":
+		x.order = binary.LittleEndian
+	case "MM":
+		x.order = binary.BigEndian
+	default:
+		return nil, errors.New("EXIF字节序无效")
+	}
+	return x, nil
+}
+
+// ifd0 获取第一个IFD的位置
+func (x *exifEditor) ifd0() int {
+	return int(x.order.Uint32(x.tiff[4:]))
+}
+
+// entries 获取位于offset的IFD中的所有条目，数据越界时返回已读取的部分
+func (x *exifEditor) entries(offset int) []ifdEntry {
+	if offset <= 0 || offset+2 > len(x.tiff) {
+		return nil
+	}
+	n := int(x.order.Uint16(x.tiff[offset:]))
+	var result []ifdEntry
+	for i := 0; i < n; i++ {
+		pos := offset + 2 + i*12
+		if pos+12 > len(x.tiff) {
+			break
+		}
+		result = append(result, ifdEntry{
+			tag:   x.order.Uint16(x.tiff[pos:]),
+			typ:   x.order.Uint16(x.tiff[pos+2:]),
+			count: x.order.Uint32(x.tiff[pos+4:]),
+			pos:   pos,
+		})
+	}
+	return result
+}
+
+// find 在位于offset的IFD中查找标签
+func (x *exifEditor) find(offset int, tag uint16) (ifdEntry, bool) {
+	for _, e := range x.entries(offset) {
+		if e.tag == tag {
+			return e, true
+		}
+	}
+	return ifdEntry{}, false
+}
+
+// subIFD 获取IFD0中指针标签指向的子IFD位置，如Exif子IFD、GPS子IFD
+func (x *exifEditor) subIFD(tag uint16) (int, bool) {
+	e, ok := x.find(x.ifd0(), tag)
+	if !ok || e.typ != tiffLong {
+		return 0, false
+	}
+	return int(x.order.Uint32(x.tiff[e.pos+8:])), true
+}
+
+// value 获取条目的值所在的数据。值不超过4字节时直接存放在条目中，否则存放在条目指向的位置
+func (x *exifEditor) value(e ifdEntry) []byte {
+	if int(e.typ) >= len(tiffTypeSize) {
+		return nil
+	}
+	size := tiffTypeSize[e.typ] * int(e.count)
+	if size <= 4 {
+		return x.tiff[e.pos+8 : e.pos+8+size]
+	}
+	offset := int(x.order.Uint32(x.tiff[e.pos+8:]))
+	if offset < 0 || offset+size > len(x.tiff) {
+		return nil
+	}
+	return x.tiff[offset : offset+size]
+}
+
+// setInt 修改位于offset的IFD中的整数标签，只支持单个SHORT或LONG值。标签不存在时返回false
+func (x *exifEditor) setInt(offset int, tag uint16, v uint32) bool {
+	e, ok := x.find(offset, tag)
+	if !ok || e.count != 1 {
+		return false
+	}
+	switch e.typ {
+	case tiffShort:
+		x.order.PutUint16(x.tiff[e.pos+8:], uint16(v))
+	case tiffLong:
+		x.order.PutUint32(x.tiff[e.pos+8:], v)
+	default:
+		return false
+	}
+	return true
+}
+
+// setDimensions 将EXIF中记录的图像宽高改为实际宽高
+func (x *exifEditor) setDimensions(width int, height int) {
+	if offset, ok := x.subIFD(tagExifIFD); ok {
+		x.setInt(offset, tagPixelXDimension, uint32(width))
+		x.setInt(offset, tagPixelYDimension, uint32(height))
+	}
+}
+
+// resetOrientation 将方向值改为1（正常方向），用于像素已经按原方向值旋转过的照片
+func (x *exifEditor) resetOrientation() {
+	x.setInt(x.ifd0(), tagOrientation, 1)
+}
+
+// stripGPS 删除EXIF中的GPS信息：清空GPS子IFD中所有条目及其指向的数据，并将条目数改为0
+func (x *exifEditor) stripGPS() {
+	offset, ok := x.subIFD(tagGPSIFD)
+	if !ok {
+		return
+	}
+	entries := x.entries(offset)
+	for _, e := range entries {
+		clear(x.value(e))
+		clear(x.tiff[e.pos : e.pos+12])
+	}
+	if len(entries) > 0 {
+		x.order.PutUint16(x.tiff[offset:], 0)
+	}
+}
+
+// coarsenGPS 将EXIF中的GPS坐标四舍五入到小数点后precision位，坐标仍以度、分、秒三个有理数存储。
+// 不是标准格式的坐标无法模糊，直接清零
+func (x *exifEditor) coarsenGPS(precision int) {
+	offset, ok := x.subIFD(tagGPSIFD)
+	if !ok {
+		return
+	}
+	for _, tag := range gpsCoordTags {
+		e, ok := x.find(offset, tag)
+		if !ok {
+			continue
+		}
+		v := x.value(e)
+		if v == nil {
+			continue
+		}
+		if e.typ != tiffRational || e.count != 3 {
+			clear(v)
+			continue
+		}
+		//读取度、分、秒，换算为十进制度数
+		var deg float64
+		for i, unit := range []float64{1, 60, 3600} {
+			num := x.order.Uint32(v[i*8:])
+			den := x.order.Uint32(v[i*8+4:])
+			if den != 0 {
+				deg += float64(num) / float64(den) / unit
+			}
+		}
+		//四舍五入后重新写为度、分、秒，秒保留两位小数
+		deg = roundTo(deg, precision)
+		d := math.Floor(deg)
+		m := math.Floor((deg - d) * 60)
+		sec := math.Round(((deg-d)*60 - m) * 60 * 100)
+		for i, r := range [][2]uint32{{uint32(d), 1}, {uint32(m), 1}, {uint32(sec), 100}} {
+			x.order.PutUint32(v[i*8:], r[0])
+			x.order.PutUint32(v[i*8+4:], r[1])
+		}
+	}
+}
+
+// roundTo 将数值四舍五入到小数点后precision位
+func roundTo(v float64, precision int) float64 {
+	p := math.Pow10(precision)
+	return math.Round(v*p) / p
+}
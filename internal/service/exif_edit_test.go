@@ -0,0 +1,350 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// testPhoto 测试照片的EXIF信息，零值的字段不写入
+type testPhoto struct {
+	orientation int
+	date        string //EXIF格式的拍摄时间，如 2024:05:01 10:00:00
+	lat         float64
+	long        float64
+	width       int
+	height      int
+}
+
+// tiffTag 测试用的TIFF条目，data为按小端序编码的值
+type tiffTag struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+// ifdSize 计算IFD及其溢出数据占用的字节数
+func ifdSize(tags []tiffTag) int {
+	size := 2 + 12*len(tags) + 4
+	for _, t := range tags {
+		if len(t.data) > 4 {
+			size += len(t.data)
+		}
+	}
+	return size
+}
+
+// encodeIFD 编码位于offset的IFD，超过4字节的值紧跟在IFD之后
+func encodeIFD(offset int, tags []tiffTag) []byte {
+	le := binary.LittleEndian
+	out := le.AppendUint16(nil, uint16(len(tags)))
+	var extra []byte
+	dataPos := offset + 2 + 12*len(tags) + 4
+	for _, t := range tags {
+		out = le.AppendUint16(out, t.tag)
+		out = le.AppendUint16(out, t.typ)
+		out = le.AppendUint32(out, t.count)
+		if len(t.data) <= 4 {
+			out = append(out, append(t.data, make([]byte, 4-len(t.data))...)...)
+			continue
+		}
+		out = le.AppendUint32(out, uint32(dataPos+len(extra)))
+		extra = append(extra, t.data...)
+	}
+	out = le.AppendUint32(out, 0)
+	return append(out, extra...)
+}
+
+// uint32Data 将整数编码为LONG值
+func uint32Data(v int) []byte {
+	return binary.LittleEndian.AppendUint32(nil, uint32(v))
+}
+
+// degreeData 将十进制度数编码为度、分、秒三个有理数，秒保留四位小数
+func degreeData(deg float64) []byte {
+	deg = math.Abs(deg)
+	d := math.Floor(deg)
+	m := math.Floor((deg - d) * 60)
+	s := math.Round(((deg-d)*60 - m) * 60 * 10000)
+	var out []byte
+	for _, r := range [][2]uint32{{uint32(d), 1}, {uint32(m), 1}, {uint32(s), 10000}} {
+		out = binary.LittleEndian.AppendUint32(out, r[0])
+		out = binary.LittleEndian.AppendUint32(out, r[1])
+	}
+	return out
+}
+
+// makeExifSegment 按测试照片的信息生成包含IFD0、Exif子IFD和GPS子IFD的APP1段
+func makeExifSegment(p testPhoto) []byte {
+	var exifTags, gpsTags []tiffTag
+	if p.date != "" {
+		exifTags = append(exifTags, tiffTag{0x9003, 2, 20, append([]byte(p.date), 0)})
+	}
+	if p.width != 0 {
+		exifTags = append(exifTags,
+			tiffTag{tagPixelXDimension, tiffLong, 1, uint32Data(p.width)},
+			tiffTag{tagPixelYDimension, tiffLong, 1, uint32Data(p.height)})
+	}
+	if p.lat != 0 || p.long != 0 {
+		latRef, longRef := "N", "E"
+		if p.lat < 0 {
+			latRef = "S"
+		}
+		if p.long < 0 {
+			longRef = "W"
+		}
+		gpsTags = []tiffTag{
+			{0x0001, 2, 2, []byte(latRef + "\x00")},
+			{0x0002, tiffRational, 3, degreeData(p.lat)},
+			{0x0003, 2, 2, []byte(longRef + "\x00")},
+			{0x0004, tiffRational, 3, degreeData(p.long)},
+		}
+	}
+
+	//IFD0中的指针不超过4字节，IFD0的大小与指针的值无关，可以先计算各IFD的位置
+	ifd0 := []tiffTag{{tagExifIFD, tiffLong, 1, nil}, {tagGPSIFD, tiffLong, 1, nil}}
+	if p.orientation != 0 {
+		ifd0 = append([]tiffTag{{tagOrientation, tiffShort, 1, binary.LittleEndian.AppendUint16(nil, uint16(p.orientation))}}, ifd0...)
+	}
+	exifPos := 8 + ifdSize(ifd0)
+	gpsPos := exifPos + ifdSize(exifTags)
+	ifd0[len(ifd0)-2].data = uint32Data(exifPos)
+	ifd0[len(ifd0)-1].data = uint32Data(gpsPos)
+
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = append(tiff, encodeIFD(8, ifd0)...)
+	tiff = append(tiff, encodeIFD(exifPos, exifTags)...)
+	tiff = append(tiff, encodeIFD(gpsPos, gpsTags)...)
+
+	seg := []byte{0xFF, 0xE1}
+	seg = binary.BigEndian.AppendUint16(seg, uint16(2+len(exifHeader)+len(tiff)))
+	seg = append(seg, exifHeader...)
+	return append(seg, tiff...)
+}
+
+// makeJPEG 生成带有测试照片EXIF信息的JPEG数据
+func makeJPEG(t *testing.T, p testPhoto) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 4)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return insertExifSegment(buf.Bytes(), makeExifSegment(p))
+}
+
+// writeJPEG 在dir下写入测试照片，返回照片路径
+func writeJPEG(t *testing.T, dir string, name string, p testPhoto) string {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, makeJPEG(t, p), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// decodeSegment 用goexif解码APP1段，用于检查修改后的结果
+func decodeSegment(t *testing.T, seg []byte) *exif.Exif {
+	t.Helper()
+	x, err := exif.Decode(bytes.NewReader(insertExifSegment([]byte{0xFF, 0xD8, 0xFF, 0xD9}, seg)))
+	if err != nil {
+		t.Fatalf("解码EXIF失败：%v", err)
+	}
+	return x
+}
+
+func TestExifSegment(t *testing.T) {
+	seg := makeExifSegment(testPhoto{date: "2024:05:01 10:00:00"})
+	data := makeJPEG(t, testPhoto{date: "2024:05:01 10:00:00"})
+	if got := exifSegment(data); !bytes.Equal(got, seg) {
+		t.Fatalf("exifSegment未找到插入的APP1段")
+	}
+	if got := exifSegment([]byte{0xFF, 0xD8, 0xFF, 0xD9}); got != nil {
+		t.Fatalf("没有EXIF的JPEG返回了%v", got)
+	}
+	if got := exifSegment([]byte("not a jpeg")); got != nil {
+		t.Fatalf("非JPEG数据返回了%v", got)
+	}
+}
+
+func TestResetOrientation(t *testing.T) {
+	tests := []struct {
+		name        string
+		orientation int
+		want        int
+	}{
+		{"旋转90度", 6, 1},
+		{"镜像", 2, 1},
+		{"已是正常方向", 1, 1},
+		{"没有方向标签", 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seg := makeExifSegment(testPhoto{orientation: tt.orientation, date: "2024:05:01 10:00:00"})
+			size := len(seg)
+			x, err := newExifEditor(seg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			x.resetOrientation()
+			if len(seg) != size {
+				t.Fatalf("APP1段长度从%d变为%d", size, len(seg))
+			}
+			if got := readOrientation(decodeSegment(t, seg)); got != tt.want {
+				t.Errorf("方向值为%d，应为%d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetDimensions(t *testing.T) {
+	seg := makeExifSegment(testPhoto{width: 4000, height: 3000})
+	x, err := newExifEditor(seg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.setDimensions(1600, 1200)
+	ex := decodeSegment(t, seg)
+	for tag, want := range map[exif.FieldName]int{exif.PixelXDimension: 1600, exif.PixelYDimension: 1200} {
+		v, err := ex.Get(tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := v.Int(0); got != want {
+			t.Errorf("%s为%d，应为%d", tag, got, want)
+		}
+	}
+}
+
+func TestCarryExif(t *testing.T) {
+	original := makeJPEG(t, testPhoto{date: "2024:05:01 10:00:00", width: 4000, height: 3000})
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 2)), nil); err != nil {
+		t.Fatal(err)
+	}
+	out := carryExif(original, buf.Bytes(), 4, 2, &config.UserConfig{PhotoGPS: config.PhotoGPS_Keep})
+	x, err := exif.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("写回后无法读取EXIF：%v", err)
+	}
+	if _, err := x.DateTime(); err != nil {
+		t.Errorf("拍摄时间丢失：%v", err)
+	}
+	if v, _ := x.Get(exif.PixelXDimension); v == nil || v.String() != "4" {
+		t.Errorf("图像宽度应改为实际宽度：%v", v)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("写回EXIF后不是有效的JPEG：%v", err)
+	}
+	//按隐私设置删除GPS信息
+	withGPS := makeJPEG(t, testPhoto{lat: 39.9, long: 116.3})
+	stripped, err := exif.Decode(bytes.NewReader(carryExif(withGPS, buf.Bytes(), 4, 2, &config.UserConfig{PhotoGPS: config.PhotoGPS_Strip})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := stripped.LatLong(); err == nil {
+		t.Errorf("写回的EXIF中仍有经纬度")
+	}
+	//原照片没有EXIF时原样返回
+	if got := carryExif(buf.Bytes(), buf.Bytes(), 4, 2, &config.UserConfig{}); !bytes.Equal(got, buf.Bytes()) {
+		t.Errorf("原照片没有EXIF时不应修改")
+	}
+}
+
+func TestStripGPS(t *testing.T) {
+	tests := []struct {
+		name  string
+		photo testPhoto
+	}{
+		{"北半球东经", testPhoto{lat: 39.907345, long: 116.391234, date: "2024:05:01 10:00:00"}},
+		{"南半球西经", testPhoto{lat: -33.856784, long: -70.651234}},
+		{"没有GPS信息", testPhoto{orientation: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seg := makeExifSegment(tt.photo)
+			x, err := newExifEditor(seg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			x.stripGPS()
+			ex := decodeSegment(t, seg)
+			if _, _, err := ex.LatLong(); err == nil {
+				t.Errorf("删除GPS信息后仍能读取经纬度")
+			}
+			if bytes.Contains(seg, degreeData(tt.photo.lat)) && tt.photo.lat != 0 {
+				t.Errorf("删除GPS信息后仍残留纬度数据")
+			}
+			if tt.photo.date != "" {
+				if _, err := ex.DateTime(); err != nil {
+					t.Errorf("删除GPS信息时不应影响拍摄时间：%v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestCoarsenGPS(t *testing.T) {
+	tests := []struct {
+		name      string
+		lat, long float64
+		precision int
+	}{
+		{"保留两位", 39.907345, 116.391234, 2},
+		{"保留一位", 39.907345, 116.391234, 1},
+		{"保留三位", 31.230416, 121.473701, 3},
+		{"保留整数", 22.543096, 114.057865, 0},
+		{"南半球西经", -33.856784, -70.651234, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seg := makeExifSegment(testPhoto{lat: tt.lat, long: tt.long})
+			size := len(seg)
+			x, err := newExifEditor(seg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			x.coarsenGPS(tt.precision)
+			if len(seg) != size {
+				t.Fatalf("APP1段长度从%d变为%d", size, len(seg))
+			}
+			lat, long, err := decodeSegment(t, seg).LatLong()
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantLat, wantLong := roundTo(tt.lat, tt.precision), roundTo(tt.long, tt.precision)
+			if math.Abs(lat-wantLat) > 1e-5 || math.Abs(long-wantLong) > 1e-5 {
+				t.Errorf("模糊后为(%f,%f)，应为(%f,%f)", lat, long, wantLat, wantLong)
+			}
+		})
+	}
+}
+
+func TestRoundTo(t *testing.T) {
+	tests := []struct {
+		v         float64
+		precision int
+		want      float64
+	}{
+		{39.907345, 2, 39.91},
+		{39.904999, 2, 39.90},
+		{116.391234, 0, 116},
+		{-70.651234, 1, -70.7},
+	}
+	for _, tt := range tests {
+		if got := roundTo(tt.v, tt.precision); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("roundTo(%v, %d) = %v，应为%v", tt.v, tt.precision, got, tt.want)
+		}
+	}
+}
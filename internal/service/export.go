@@ -0,0 +1,155 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// 可选的额外导出格式
+const (
+	Export_GeoJSON = "GeoJSON"
+	Export_KML     = "KML"
+	Export_KMZ     = "KMZ"
+	Export_GPX     = "GPX"
+	Export_CSV     = "CSV"
+	Export_XLSX    = "XLSX"
+)
+
+// ExportFormats 所有可选的额外导出格式
+var ExportFormats = []string{
+	Export_GeoJSON,
+	Export_KML,
+	Export_KMZ,
+	Export_GPX,
+	Export_CSV,
+	Export_XLSX,
+}
+
+// exportPoint 额外导出中的一张照片，包括本次的有效照片和更新模式下旅行记录中已有的标记点
+type exportPoint struct {
+	name        string   //照片文件名
+	path        string   //照片路径，用于打包KMZ，找不到照片时为空
+	link        string   //照片的文件链接，找不到照片时为空
+	date        string   //拍摄时间
+	device      string   //拍摄设备
+	raw         location //WGS-84坐标
+	converted   location //高德坐标
+	altitude    float64  //海拔，未知时为NaN
+	orientation int      //照片方向
+	marker      string   //标记点文件名，不含扩展名
+	existing    bool     //是否为更新前已有的标记点
+}
+
+// exportPoints 获取需要导出的照片，本次的有效照片在前，更新模式下已有的标记点在后。
+// 更新模式下只为新照片生成标记点，但导出的文件会被覆盖，因此需要包含已有的标记点
+func (t *TravelData) exportPoints(basePath string, cfg *config.UserConfig) []exportPoint {
+	var points []exportPoint
+	for i := range pData.validPhotos {
+		points = append(points, exportPoint{
+			name:        pData.validPhotos[i],
+			path:        t.photoSource(i),
+			link:        t.photoLink(i, basePath, cfg),
+			date:        pData.date[i],
+			device:      pData.device[i],
+			raw:         pData.rawLocation[i],
+			converted:   pData.convertedLocation[i],
+			altitude:    pData.altitude[i],
+			orientation: pData.orientation[i],
+			marker:      pData.markerNames[i],
+		})
+	}
+	for _, m := range pData.existingMarkers {
+		p := exportPoint{
+			name:      m.photo,
+			date:      m.date,
+			device:    m.device,
+			raw:       m.raw,
+			converted: m.loc,
+			altitude:  math.NaN(),
+			marker:    m.name,
+			existing:  true,
+		}
+		//旧版本生成的标记点没有WGS-84坐标，由高德坐标近似换算
+		if p.raw == (location{}) {
+			p.raw = gcj02ToWgs84(m.loc)
+		}
+		//优先使用导入目录中的原照片，原照片已删除时使用转存的照片
+		for si, src := range t.Inputs {
+			if (m.index == si || (m.index < 0 && src.Label == m.source)) && fileExists(t.sourcePath(si, m.photo)) {
+				p.path = t.sourcePath(si, m.photo)
+				break
+			}
+		}
+		copied := ""
+		if m.file != "" && cfg.MovePhoto {
+			copied = filepath.Join(copyDir(basePath, cfg), filepath.FromSlash(m.file))
+		}
+		if p.path == "" && copied != "" && fileExists(copied) {
+			p.path = copied
+		}
+		if copied != "" {
+			p.link = fileLink(copied)
+		} else if p.path != "" {
+			p.link = fileLink(p.path)
+		}
+		if p.path != "" {
+			p.orientation = fileOrientation(p.path)
+		}
+		points = append(points, p)
+	}
+	return points
+}
+
+// exportOrder 将有拍摄时间的导出照片按拍摄时间排序，返回其序号
+func exportOrder(points []exportPoint) []int {
+	var order []int
+	for i, p := range points {
+		if _, ok := parsePhotoTime(p.date); ok {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ta, _ := parsePhotoTime(points[order[a]].date)
+		tb, _ := parsePhotoTime(points[order[b]].date)
+		return ta.Before(tb)
+	})
+	return order
+}
+
+// fileExists 判断文件是否存在
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// makeExports 按本次选择的额外导出格式，在旅行记录文件夹下导出照片数据。返回导出失败的格式及原因
+func (t *TravelData) makeExports(basePath string, cfg *config.UserConfig) []string {
+	var failed []string
+	points := t.exportPoints(basePath, cfg)
+	for _, format := range t.Exports {
+		var err error
+		switch format {
+		case Export_GeoJSON:
+			err = t.exportGeoJSON(basePath, points)
+		case Export_KML:
+			err = t.exportKML(basePath, points)
+		case Export_KMZ:
+			err = t.exportKMZ(basePath, points)
+		case Export_GPX:
+			err = t.exportGPX(basePath, points)
+		case Export_CSV:
+			err = t.exportCSV(basePath, points)
+		case Export_XLSX:
+			err = t.exportXLSX(basePath, points)
+		default:
+			continue
+		}
+		if err != nil {
+			failed = append(failed, format+"："+err.Error())
+		}
+	}
+	return failed
+}
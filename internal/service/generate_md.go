@@ -2,30 +2,47 @@ package service
 
 import (
 	"MapPhotoMD/internal/config"
-	"MapPhotoMD/mywidget"
+	"MapPhotoMD/internal/model"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"image"
 	"image/jpeg"
 	"io"
-	"io/fs"
-	"log"
+	"math"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rwcarlsen/goexif/exif"
 )
 
 // TravelData 旅行记录结构体
 type TravelData struct {
-	TravelName string               //旅行名称
-	TravelDate string               //旅行日期
-	InputPath  string               //照片导入路径
-	OutputPath string               //MD文件导出路径
-	ProIndex   []*mywidget.Property //所有属性控件的指针
+	TravelName    string                   //旅行名称
+	TravelDate    string                   //旅行日期，即旅行开始的第一天
+	TravelEndDate string                   //旅行结束日期，设置后只读取在旅行日期内拍摄的照片，可为空
+	Inputs        []*model.InputSourceData //照片来源，可以有多个文件夹
+	OutputPath    string                   //MD文件导出路径
+	Properties    []*model.PropertyData    //写入旅行记录的属性
+	Exports       []string                 //额外导出的格式
+	Update        bool                     //旅行记录已存在时是否以更新模式生成，只添加新照片并保留手写的内容
+}
+
+// Report 生成结果报告
+type Report struct {
+	InvalidPhotos    []string //无法转换的照片
+	GeocodeFailed    []string //逆地理编码失败的照片
+	ExportErrors     []string //额外导出失败的格式及原因
+	ExcludedPhotos   []string //位于隐私区域内，被排除或隐藏标记点的照片
+	OutOfRangePhotos []string //不在旅行日期内拍摄、被排除的照片
+	Deduplicated     int      //转存目录中已有相同内容、未重复保存的照片数量
+	CopyFailed       []string //转存失败的照片及原因，这些照片的原照片不会被删除
+	DeleteFailed     []string //无法移到暂存目录或回收站的原照片及原因
 }
 
 // location 经纬度结构体
@@ -36,19 +53,77 @@ type location struct {
 
 // photoData 照片相关数据的结构体
 type photoData struct {
-	centerLocation    location   //leaflet地图中心坐标
-	rawLocation       []location //照片原始经纬度
-	convertedLocation []location //高德坐标下的经纬度
-	device            []string   //拍摄设备
-	date              []string   //拍摄时间
-	invalidPhotos     []string   //无法转换的照片
-	validPhotos       []string   //可以转换的照片
+	centerLocation    location          //leaflet地图中心坐标
+	zoom              int               //leaflet地图默认缩放级别
+	update            bool              //是否以更新模式生成
+	existingMarkers   []existingMarker  //更新模式下旅行记录中已有的标记点
+	existingPhotos    []string          //更新模式下已有标记点、被跳过的照片
+	recorder          *manifestRecorder //生成时记录写入的文件，未在生成时为nil
+	rawLocation       []location        //照片原始经纬度
+	convertedLocation []location        //高德坐标下的经纬度
+	device            []string          //拍摄设备
+	altitude          []float64         //海拔，单位米，没有海拔信息时为NaN
+	places            []place           //逆地理编码得到的地点信息，未开启时为空
+	orientation       []int             //EXIF方向值，没有方向信息时为1
+	thumbnails        []string          //缩略图文件名，未生成时为空
+	date              []string          //拍摄时间
+	invalidPhotos     []string          //无法转换的照片
+	invalidPaths      []string          //无法转换的照片的路径
+	invalidReasons    []string          //照片无法转换的原因
+	validPhotos       []string          //可以转换的照片
+	source            []int             //照片来源的下标
+	markerNames       []string          //标记点文件名（不含扩展名）
+	copyNames         []string          //转存后的照片文件名，未转存时为空
+	routeFile         string            //旅行路线GeoJSON文件名，未生成时为空
+	hiddenPhotos      []hiddenPhoto     //位于隐私区域内、只隐藏标记点的照片
+	outOfRange        []string          //不在旅行日期内拍摄、被排除的照片
+	excluded          []string          //位于隐私区域内，被排除或隐藏标记点的照片及其所在区域
+	filtered          []filteredPhoto   //不在旅行日期内或位于隐私区域内、被移除的照片，用于导出元数据表格
+}
+
+// filteredPhoto 读取后因不在旅行日期内或位于隐私区域内而被移除的照片
+type filteredPhoto struct {
+	name   string    //照片在导入目录中的相对路径
+	source int       //照片来源的下标
+	status string    //处理方式
+	reason string    //移除原因
+	date   string    //拍摄时间
+	device string    //拍摄设备
+	raw    *location //WGS-84坐标，位于隐私区域内的照片不记录坐标
 }
 
 var pData photoData
 
-// 高德地图坐标转化系统请求头
-const gaodeapiSiteHead = "https://restapi.amap.com/v3/assistant/coordinate/convert?locations="
+// clone 复制照片数据，生成时修改坐标、文件名等不会影响原数据
+func (p photoData) clone() photoData {
+	c := p
+	c.recorder = nil
+	c.existingMarkers = slices.Clone(p.existingMarkers)
+	c.existingPhotos = slices.Clone(p.existingPhotos)
+	c.rawLocation = slices.Clone(p.rawLocation)
+	c.convertedLocation = slices.Clone(p.convertedLocation)
+	c.device = slices.Clone(p.device)
+	c.altitude = slices.Clone(p.altitude)
+	c.places = slices.Clone(p.places)
+	c.orientation = slices.Clone(p.orientation)
+	c.thumbnails = slices.Clone(p.thumbnails)
+	c.date = slices.Clone(p.date)
+	c.invalidPhotos = slices.Clone(p.invalidPhotos)
+	c.invalidPaths = slices.Clone(p.invalidPaths)
+	c.invalidReasons = slices.Clone(p.invalidReasons)
+	c.validPhotos = slices.Clone(p.validPhotos)
+	c.source = slices.Clone(p.source)
+	c.markerNames = slices.Clone(p.markerNames)
+	c.copyNames = slices.Clone(p.copyNames)
+	c.hiddenPhotos = slices.Clone(p.hiddenPhotos)
+	c.outOfRange = slices.Clone(p.outOfRange)
+	c.excluded = slices.Clone(p.excluded)
+	c.filtered = slices.Clone(p.filtered)
+	return c
+}
+
+// 高德地图坐标转化接口路径
+const amapConvertPath = "/v3/assistant/coordinate/convert?locations="
 
 // NewTravelData 创建照片数据结构体
 func NewTravelData() *TravelData {
@@ -56,50 +131,192 @@ func NewTravelData() *TravelData {
 }
 
 // GenerateMD 读取指定导入目录下的照片，在指定导出目录下按用户配置生成旅行记录MD文件夹
-func (travelData *TravelData) GenerateMD(cfg *config.UserConfig) []string {
+func (travelData *TravelData) GenerateMD(cfg *config.UserConfig) (*Report, error) {
+	plan, err := travelData.PlanMD(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return travelData.Execute(plan, cfg), nil
+}
+
+// Execute 按生成计划生成旅行记录MD文件夹。使用计划中保存的照片数据，之后再次制定计划不影响按本计划生成
+func (travelData *TravelData) Execute(plan *Plan, cfg *config.UserConfig) *Report {
+	genMu.Lock()
+	defer genMu.Unlock()
+	//使用制定计划时读取的照片数据，期间再次制定计划也不影响按本计划生成
+	pData = plan.data.clone()
+
 	//旅行记录文件夹根目录
-	basePath := filepath.Join(travelData.OutputPath, travelData.TravelName)
+	basePath := plan.BasePath
 	os.MkdirAll(basePath, 0755)
 
-	//获取照片中的位置信息
-	travelData.decodeEXIF(cfg)
+	//记录本次生成写入的文件，覆盖前先备份，生成结束后保存清单
+	now := time.Now()
+	id := manifestID(basePath, now)
+	recorder := newManifestRecorder(basePath, id)
+	pData.recorder = recorder
+	defer func() { pData.recorder = nil }()
+
+	//获取照片拍摄地点的名称
+	geocodeFailed := travelData.reverseGeocode(cfg)
+	//按隐私设置模糊坐标，需在逆地理编码之后、写入任何文件之前完成
+	coarsenLocations(cfg)
+	//生成旅行路线
+	travelData.makeRoute(basePath, cfg)
 	//创建旅行记录文件及其文件夹
 	travelData.makeTravelNote(basePath, cfg)
+	//转存照片，需在创建标记点之前完成，以便标记点引用去重后的文件名
+	deduplicated, verified, copyFailed := travelData.movePhoto(basePath, cfg)
+	//生成缩略图
+	travelData.makeThumbnails(basePath, cfg)
 	//创建标记点文件及其文件夹
-	travelData.makeMarkers(basePath)
-	//转存照片
-	travelData.movePhoto(basePath, cfg)
+	travelData.makeMarkers(basePath, cfg)
+	//额外导出，KMZ需要读取原照片，因此需在删除原照片之前完成
+	exportErrors := travelData.makeExports(basePath, cfg)
 	//删除原照片
-	travelData.deletePhoto(cfg)
-	//返回无法转换的照片名
-	return pData.invalidPhotos
+	deleted, deleteFailed := travelData.deletePhoto(verified, cfg)
+	//保存生成清单
+	pData.recorder = nil
+	if err := travelData.saveManifest(recorder, id, now.Format("2006-01-02 15:04:05"), basePath, deleted, cfg); err != nil {
+		exportErrors = append(exportErrors, "生成清单："+err.Error())
+	}
+	//返回生成结果
+	return &Report{
+		InvalidPhotos:    pData.invalidPhotos,
+		GeocodeFailed:    geocodeFailed,
+		ExportErrors:     exportErrors,
+		ExcludedPhotos:   plan.ExcludedPhotos,
+		OutOfRangePhotos: plan.OutOfRangePhotos,
+		Deduplicated:     deduplicated,
+		CopyFailed:       copyFailed,
+		DeleteFailed:     deleteFailed,
+	}
+}
+
+// addInvalidPhoto 记录一张无法转换的照片及其原因
+func addInvalidPhoto(fileName string, path string, reason string) {
+	pData.invalidPhotos = append(pData.invalidPhotos, fileName)
+	pData.invalidPaths = append(pData.invalidPaths, path)
+	pData.invalidReasons = append(pData.invalidReasons, reason)
+}
+
+// addFilteredPhoto 记录第i张有效照片被移除的原因，withLocation为false时不记录其坐标
+func addFilteredPhoto(i int, status string, reason string, withLocation bool) {
+	f := filteredPhoto{
+		name:   pData.validPhotos[i],
+		source: pData.source[i],
+		status: status,
+		reason: reason,
+		date:   pData.date[i],
+		device: pData.device[i],
+	}
+	if withLocation {
+		raw := pData.rawLocation[i]
+		f.raw = &raw
+	}
+	pData.filtered = append(pData.filtered, f)
+}
+
+// readAltitude 读取照片EXIF中的海拔，没有海拔信息时返回NaN
+func readAltitude(x *exif.Exif) float64 {
+	altTag, err := x.Get(exif.GPSAltitude)
+	if err != nil {
+		return math.NaN()
+	}
+	rat, err := altTag.Rat(0)
+	if err != nil {
+		return math.NaN()
+	}
+	alt, _ := rat.Float64()
+	//海拔参考为1时表示海平面以下
+	if refTag, err := x.Get(exif.GPSAltitudeRef); err == nil {
+		if ref, err := refTag.Int(0); err == nil && ref == 1 {
+			alt = -alt
+		}
+	}
+	return alt
+}
+
+// readOrientation 读取照片EXIF中的方向值，没有方向信息时返回1
+func readOrientation(x *exif.Exif) int {
+	tag, err := x.Get(exif.Orientation)
+	if err != nil {
+		return 1
+	}
+	o, err := tag.Int(0)
+	if err != nil {
+		return 1
+	}
+	return o
+}
+
+// fileOrientation 读取照片文件EXIF中的方向，读取失败时视为正常方向
+func fileOrientation(path string) int {
+	file, err := os.Open(path)
+	if err != nil {
+		return 1
+	}
+	defer file.Close()
+	x, err := exif.Decode(file)
+	if err != nil {
+		return 1
+	}
+	return readOrientation(x)
 }
 
-// makeTravelNote 创建旅行记录MD文件
+// makeTravelNote 创建旅行记录MD文件。更新模式下只重写其中生成的部分和到访地点，保留手写的属性和正文
 func (travelData *TravelData) makeTravelNote(basePath string, cfg *config.UserConfig) {
 	path := filepath.Join(basePath, travelData.TravelName+".md")
-	file, _ := os.Create(path)
+	region := travelData.leafletRegion(cfg)
+	if pData.update {
+		if old, err := os.ReadFile(path); err == nil {
+			//合并已有标记点和新照片的到访地点，其余属性保持不变
+			note := replaceRegion(string(old), region)
+			note = replaceYAMLList(note, "countries", visited(func(p place) string { return p.Country }))
+			note = replaceYAMLList(note, "provinces", visited(func(p place) string { return p.Province }))
+			note = replaceYAMLList(note, "cities", visited(func(p place) string { return p.City }))
+			writeFile(path, []byte(note))
+			return
+		}
+	}
+
+	file, _ := createFile(path)
 	defer file.Close()
 
 	//将设置的属性写入旅行记录MD文件中
 	file.WriteString("---\n")
-	for _, pro := range travelData.ProIndex {
+	for _, pro := range travelData.Properties {
 		//对不同属性类型进行解析和写入
-		switch pro.ProType.Selected {
-		case mywidget.ProType_List:
-			file.WriteString(pro.GetPropertyName() + ": \n")
-			items := strings.Split(pro.GetPropertyValue(), ",")
+		switch pro.Type {
+		case model.ProType_List:
+			file.WriteString(pro.Name + ": \n")
+			items := strings.Split(pro.Value, ",")
 			for _, item := range items {
 				file.WriteString("  - " + item + "\n")
 			}
 		default:
-			file.WriteString(pro.GetPropertyName() + ": " + pro.GetPropertyValue() + "\n")
+			file.WriteString(pro.Name + ": " + pro.Value + "\n")
 		}
 	}
+	//写入旅行结束日期
+	if travelData.TravelEndDate != "" {
+		file.WriteString("end_date: " + travelData.TravelEndDate + "\n")
+	}
+	//写入逆地理编码得到的到访国家、省份和城市
+	writeYAMLList(file, "countries", visited(func(p place) string { return p.Country }))
+	writeYAMLList(file, "provinces", visited(func(p place) string { return p.Province }))
+	writeYAMLList(file, "cities", visited(func(p place) string { return p.City }))
 	file.WriteString("---\n\n")
 
 	//写入Leaflet代码块
-	file.WriteString("```leaflet\n")
+	file.WriteString(region)
+}
+
+// leafletRegion 生成旅行记录中由程序维护的部分，即用起止标记包围的Leaflet代码块
+func (travelData *TravelData) leafletRegion(cfg *config.UserConfig) string {
+	var region strings.Builder
+	region.WriteString(regionBegin + "\n")
+	region.WriteString("```leaflet\n")
 	leafCode := fmt.Sprintf(`id: %s
 osmLayer: false
 tileServer: http://webrd0{s}.is.autonavi.com/appmaptile?lang=zh_cn&size=1&scale=1&style=8&x={x}&y={y}&z={z}
@@ -108,130 +325,294 @@ lat: %v
 long: %v
 height: 500px
 width: 100%%
-defaultZoom: 16
+defaultZoom: %d
 maxzoom: 18
 minzoom: 1
 unit: meters
 scale: 1
 markerFolder: %s/%s/markers
-`, travelData.TravelDate, pData.centerLocation.lat, pData.centerLocation.long, cfg.NotePath, travelData.TravelName)
-	file.WriteString(leafCode)
-	file.WriteString("```\n")
+`, travelData.TravelDate, pData.centerLocation.lat, pData.centerLocation.long, pData.zoom, cfg.NotePath, travelData.TravelName)
+	region.WriteString(leafCode)
+	//引用旅行路线
+	if pData.routeFile != "" {
+		region.WriteString(fmt.Sprintf("geojson: [[%s/%s/%s]]\n", cfg.NotePath, travelData.TravelName, pData.routeFile))
+		region.WriteString("geojsonColor: " + cfg.RouteColor + "\n")
+	}
+	region.WriteString("```\n")
+	region.WriteString(regionEnd + "\n")
+	return region.String()
 }
 
-// decodeEXIF 读取照片的EXIF信息，将定位信息转换为高德坐标，并计算地图的中心坐标
-func (travelData *TravelData) decodeEXIF(cfg *config.UserConfig) {
-	//读取照片的EXIF
-	filepath.Walk(travelData.InputPath, func(path string, info fs.FileInfo, err error) error {
+// writeYAMLList 写入YAML列表属性，列表为空时不写入
+func writeYAMLList(w io.StringWriter, name string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	w.WriteString(name + ": \n")
+	for _, item := range items {
+		w.WriteString("  - " + yamlValue(item) + "\n")
+	}
+}
+
+// decodeEXIF 读取照片的EXIF信息，排除旅行日期之外、隐私区域内以及更新模式下已有标记点的照片后，将定位信息转换为高德坐标。坐标转换失败时返回错误
+func (travelData *TravelData) decodeEXIF(cfg *config.UserConfig) error {
+	for si, src := range travelData.Inputs {
+		//相机时钟偏差，用于校正拍摄时间
+		offset, err := parseClockOffset(src.ClockOffset)
+		if err != nil {
+			return fmt.Errorf("%s的时钟偏差格式错误：%s", src.Path, src.ClockOffset)
+		}
+		//按设置列出导入目录及其子文件夹中的照片，照片以相对路径区分，不同子文件夹中的同名照片不会冲突
+		photos, err := listPhotos(src.Path, cfg)
 		if err != nil {
 			return err
 		}
-		if !info.IsDir() {
-			fileExt := filepath.Ext(path)
-			if fileExt == ".jpg" { //只读取jpg格式的文件
-				file, _ := os.Open(path)
-				defer file.Close()
-				fileName := filepath.Base(path)
-
-				//解码EXIF信息
-				x, e := exif.Decode(file)
-				if e != nil {
-					pData.invalidPhotos = append(pData.invalidPhotos, fileName)
-					return nil
-				}
-
-				//读取照片经纬度
-				raw := location{}
-				raw.lat, raw.long, e = x.LatLong()
-				if e != nil || raw.lat == 0 || raw.long == 0 {
-					pData.invalidPhotos = append(pData.invalidPhotos, fileName)
-					return nil
-				}
-				pData.rawLocation = append(pData.rawLocation, raw)
-				pData.validPhotos = append(pData.validPhotos, fileName)
-
-				//读取拍摄日期
-				time, e := x.DateTime()
-				if e != nil {
-					pData.date = append(pData.date, "")
-					return nil
-				}
-				pData.date = append(pData.date, time.Format("2006-01-02 15:04:05"))
-
-				//读取拍摄设备
-				camModel, e := x.Get(exif.Model)
-				if e != nil {
-					pData.device = append(pData.device, "")
-					return nil
-				}
-				pData.device = append(pData.device, strings.Trim(camModel.String(), `"`))
-			}
+		//读取照片的EXIF
+		for _, rel := range photos {
+			readPhoto(rel, travelData.sourcePath(si, rel), si, offset)
 		}
-		return nil
-	})
+	}
+	//按旅行日期筛选照片，之后再转换坐标，不将旅行之外的照片坐标发送给高德
+	outOfRange, err := travelData.filterDateRange()
+	if err != nil {
+		return err
+	}
+	pData.outOfRange = outOfRange
+	//处理位于隐私区域内的照片，之后再转换坐标，不将区域内的照片坐标发送给高德
+	pData.excluded = applyGeofences(cfg)
+	//更新模式下跳过已有标记点的照片，只转换新照片的坐标
+	if pData.update {
+		pData.existingPhotos = travelData.skipExistingPhotos()
+	}
 	//转换坐标
-	var totalLat float64
-	var totalLong float64
 	for _, raw := range pData.rawLocation {
-		gaodeApiSite := fmt.Sprintf("%s%v,%v&coordsys=gps&output=json&key=%s", gaodeapiSiteHead, raw.long, raw.lat, cfg.Key)
+		gaodeApiSite := fmt.Sprintf("%s%s%v,%v&coordsys=gps&output=json&key=%s", amapBaseURL(cfg), amapConvertPath, raw.long, raw.lat, cfg.Key)
 
 		resp, err := http.Get(gaodeApiSite)
 		if err != nil {
-			log.Fatalf("Failed to make request: %v", err)
+			return fmt.Errorf("坐标转换请求失败：%v", err)
 		}
-		defer resp.Body.Close()
-
 		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
 		if err != nil {
-			log.Fatalf("Failed to read response body: %v", err)
+			return fmt.Errorf("读取坐标转换结果失败：%v", err)
 		}
 
 		var respMap map[string]interface{}
 		if err := json.Unmarshal(body, &respMap); err != nil {
-			log.Fatalf("Failed to unmarshal JSON: %v", err)
+			return fmt.Errorf("解析坐标转换结果失败：%v", err)
 		}
 
 		locations, ok := respMap["locations"].(string)
 		if !ok {
-			log.Fatalf("locations is not a string or is nil: %v", respMap["locations"])
+			return fmt.Errorf("坐标转换失败，请检查高德Key：%v", respMap["info"])
 		}
 
 		l := strings.Split(locations, ",")
+		if len(l) < 2 {
+			return fmt.Errorf("坐标转换结果格式错误：%s", locations)
+		}
 		tempLat, _ := strconv.ParseFloat(l[1], 64)
 		tempLong, _ := strconv.ParseFloat(l[0], 64)
 		pData.convertedLocation = append(pData.convertedLocation, location{
 			tempLat,
 			tempLong,
 		})
-		totalLat += tempLat
-		totalLong += tempLong
 	}
-	//计算地图中心坐标
-	length := float64(len(pData.convertedLocation))
+	return nil
+}
+
+// readPhoto 读取一张照片的EXIF信息，有经纬度时加入有效照片，否则记为无法转换的照片。
+// rel为照片在导入目录中的相对路径，source为照片来源的下标，offset为该来源的相机时钟偏差
+func readPhoto(rel string, path string, source int, offset time.Duration) {
+	file, e := os.Open(path)
+	if e != nil {
+		addInvalidPhoto(rel, path, "无法打开文件")
+		return
+	}
+	defer file.Close()
+
+	//解码EXIF信息
+	x, e := exif.Decode(file)
+	if e != nil {
+		addInvalidPhoto(rel, path, "无法读取EXIF信息")
+		return
+	}
+
+	//读取照片经纬度
+	raw := location{}
+	raw.lat, raw.long, e = x.LatLong()
+	if e != nil || raw.lat == 0 || raw.long == 0 {
+		addInvalidPhoto(rel, path, "没有经纬度信息")
+		return
+	}
+	pData.rawLocation = append(pData.rawLocation, raw)
+	pData.validPhotos = append(pData.validPhotos, rel)
+	pData.source = append(pData.source, source)
+
+	//读取拍摄日期，读取失败时留空，保证各切片一一对应
+	time, e := x.DateTime()
+	if e != nil {
+		pData.date = append(pData.date, "")
+	} else {
+		pData.date = append(pData.date, time.Add(offset).Format("2006-01-02 15:04:05"))
+	}
+
+	//读取拍摄设备
+	camModel, e := x.Get(exif.Model)
+	if e != nil {
+		pData.device = append(pData.device, "")
+	} else {
+		pData.device = append(pData.device, strings.Trim(camModel.String(), `"`))
+	}
+
+	//读取海拔
+	pData.altitude = append(pData.altitude, readAltitude(x))
+
+	//读取方向
+	pData.orientation = append(pData.orientation, readOrientation(x))
+}
+
+// updateCenter 以所有有效照片（更新模式下包括已有标记点）高德坐标的平均值作为地图中心坐标，并计算能显示所有照片的缩放级别
+func updateCenter() {
+	locations := append([]location(nil), pData.convertedLocation...)
+	for _, m := range pData.existingMarkers {
+		locations = append(locations, m.loc)
+	}
+	var totalLat float64
+	var totalLong float64
+	for _, loc := range locations {
+		totalLat += loc.lat
+		totalLong += loc.long
+	}
+	length := float64(len(locations))
 	pData.centerLocation.lat = totalLat / length
 	pData.centerLocation.long = totalLong / length
+	pData.zoom = fitZoom(locations)
 }
 
-// makeMarkers 创建标记点MD文件
-func (t *TravelData) makeMarkers(basePath string) {
+// 地图的默认缩放级别，也是自动计算缩放级别时的上限
+const defaultZoom = 16
+
+// fitZoom 计算能在地图中完整显示所有坐标的最大缩放级别。按Web墨卡托投影、地图显示区域约500像素估算
+func fitZoom(locations []location) int {
+	if len(locations) < 2 {
+		return defaultZoom
+	}
+	//墨卡托投影下的纬度，单位与经度相同
+	mercator := func(lat float64) float64 {
+		return math.Log(math.Tan(math.Pi/4+lat*math.Pi/360)) * 180 / math.Pi
+	}
+	minLat, maxLat := locations[0].lat, locations[0].lat
+	minLong, maxLong := locations[0].long, locations[0].long
+	for _, loc := range locations[1:] {
+		minLat, maxLat = math.Min(minLat, loc.lat), math.Max(maxLat, loc.lat)
+		minLong, maxLong = math.Min(minLong, loc.long), math.Max(maxLong, loc.long)
+	}
+	span := math.Max(maxLong-minLong, mercator(maxLat)-mercator(minLat))
+	if span <= 0 {
+		return defaultZoom
+	}
+	//缩放级别为z时，360度经度对应256*2^z像素，四周留出一些边距
+	zoom := int(math.Floor(math.Log2(400 * 360 / (256 * span))))
+	return max(1, min(zoom, defaultZoom))
+}
+
+// parseClockOffset 解析相机时钟偏差，如 -1h、+8h30m，为空时没有偏差
+func parseClockOffset(s string) (time.Duration, error) {
+	if strings.TrimSpace(s) == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(strings.TrimSpace(s))
+}
+
+// sourcePath 获取第source个照片来源中相对路径为rel的照片的完整路径
+func (t *TravelData) sourcePath(source int, rel string) string {
+	return filepath.Join(t.Inputs[source].Path, filepath.FromSlash(rel))
+}
+
+// sourceLabel 获取第i张有效照片的来源标签，没有设置标签时为空
+func (t *TravelData) sourceLabel(i int) string {
+	return t.Inputs[pData.source[i]].Label
+}
+
+// photoSource 获取第i张有效照片的原文件路径
+func (t *TravelData) photoSource(i int) string {
+	return t.sourcePath(pData.source[i], pData.validPhotos[i])
+}
+
+// coarsenLocations 开启模糊标记点坐标时，将所有照片和已有标记点的坐标四舍五入到设置的精度，并重新计算地图中心。
+// 标记点、旅行路线、地图中心和额外导出的文件都使用模糊后的坐标，发布Ob库时不会泄露精确位置
+func coarsenLocations(cfg *config.UserConfig) {
+	if !cfg.CoarsenMarkers {
+		return
+	}
+	round := func(loc location) location {
+		return location{roundTo(loc.lat, cfg.GPSPrecision), roundTo(loc.long, cfg.GPSPrecision)}
+	}
+	for i := range pData.validPhotos {
+		pData.rawLocation[i] = round(pData.rawLocation[i])
+		pData.convertedLocation[i] = round(pData.convertedLocation[i])
+	}
+	for i := range pData.existingMarkers {
+		pData.existingMarkers[i].raw = round(pData.existingMarkers[i].raw)
+		pData.existingMarkers[i].loc = round(pData.existingMarkers[i].loc)
+	}
+	if len(pData.validPhotos) != 0 || len(pData.existingMarkers) != 0 {
+		updateCenter()
+		pData.centerLocation = round(pData.centerLocation)
+	}
+}
+
+// makeMarkers 创建标记点MD文件，文件名由用户设置的命名模板生成，坐标只写在属性中
+func (t *TravelData) makeMarkers(basePath string, cfg *config.UserConfig) {
 	markerPath := filepath.Join(basePath, "markers")
 	os.MkdirAll(markerPath, 0755)
 	for i := range pData.validPhotos {
-		file, _ := os.Create(filepath.Join(markerPath, fmt.Sprintf("%f,%f", pData.rawLocation[i].lat, pData.rawLocation[i].long)+".md"))
+		file, _ := createFile(filepath.Join(markerPath, pData.markerNames[i]+".md"))
 
+		//按隐私设置模糊标记点坐标
+		precision := 6
+		if cfg.CoarsenMarkers {
+			precision = cfg.GPSPrecision
+		}
+		raw, converted := pData.rawLocation[i], pData.convertedLocation[i]
 		markerStr := fmt.Sprintf(`---
 mapmarker: default
+photo: %s
 date: %s
 device: %s
-gps: [%f,%f]
-gn: [%f,%f]
-location: [%f,%f]
----
-![[%s]]`, pData.date[i], pData.device[i],
-			pData.rawLocation[i].lat, pData.rawLocation[i].long,
-			pData.convertedLocation[i].lat, pData.convertedLocation[i].long,
-			pData.convertedLocation[i].lat, pData.convertedLocation[i].long,
-			pData.validPhotos[i])
+gps: [%.*f,%.*f]
+gn: [%.*f,%.*f]
+location: [%.*f,%.*f]
+`, yamlValue(pData.validPhotos[i]), pData.date[i], pData.device[i],
+			precision, raw.lat, precision, raw.long,
+			precision, converted.lat, precision, converted.long,
+			precision, converted.lat, precision, converted.long)
+		//写入照片来源标签和下标，更新时按来源下标区分不同文件夹中的同名照片
+		if label := t.sourceLabel(i); label != "" {
+			markerStr += "source: " + yamlValue(label) + "\n"
+		}
+		markerStr += fmt.Sprintf("source_index: %d\n", pData.source[i])
+		//写入逆地理编码得到的地点信息
+		p := pData.places[i]
+		for _, field := range [][2]string{
+			{"country", p.Country},
+			{"province", p.Province},
+			{"city", p.City},
+			{"district", p.District},
+			{"poi", p.POI},
+		} {
+			if field[1] != "" {
+				markerStr += field[0] + ": " + yamlValue(field[1]) + "\n"
+			}
+		}
+		//有缩略图时显示缩略图并链接到原图，否则直接显示原图
+		if pData.thumbnails[i] != "" {
+			markerStr += fmt.Sprintf("---\n![[%s]]\n[[%s|查看原图]]", pData.thumbnails[i], photoName(i))
+		} else {
+			markerStr += fmt.Sprintf("---\n![[%s]]", photoName(i))
+		}
 
 		file.WriteString(markerStr)
 
@@ -239,54 +620,182 @@ location: [%f,%f]
 	}
 }
 
-// movePhoto 转存照片文件到指定目录下（不会删除原照片）
-func (t *TravelData) movePhoto(basePath string, cfg *config.UserConfig) {
-	if cfg.MovePhoto {
-		var copyPath string
-		_, err := os.Stat(cfg.PhotoPath)
-		if err != nil { //指定目录不存在，则将转存目录改为默认目录（basePath/pictures）
-			copyPath = filepath.Join(basePath, "pictures")
-			os.MkdirAll(copyPath, 0755)
-		} else {
-			copyPath = cfg.PhotoPath
-		}
-		for _, fileName := range pData.validPhotos {
-			source, _ := os.Open(filepath.Join(t.InputPath, fileName))
-			copy, _ := os.Create(filepath.Join(copyPath, fileName))
-
-			if cfg.PhotoQuality == 100 { //质量为100时不压缩
-				io.Copy(copy, source)
-				copy.Sync() //刷新缓冲区，确保成功保存
-			} else { //压缩图片
-				img, _, err := image.Decode(source)
-				if err != nil {
-					log.Fatalf("图片解码失败: %v", err)
-				}
+// copyDir 获取照片转存目录。指定目录不存在时，使用默认目录（basePath/pictures）
+func copyDir(basePath string, cfg *config.UserConfig) string {
+	_, err := os.Stat(cfg.PhotoPath)
+	if err != nil {
+		return filepath.Join(basePath, "pictures")
+	}
+	return cfg.PhotoPath
+}
 
-				//JPEG编码选项
-				options := jpeg.Options{
-					Quality: cfg.PhotoQuality,
-				}
+// needReencode 判断转存照片时是否需要重新编码。照片质量低于100，或照片长边超过设置的最大长边时需要
+func needReencode(source io.ReadSeeker, cfg *config.UserConfig) bool {
+	if cfg.PhotoQuality < 100 {
+		return true
+	}
+	if cfg.PhotoMaxEdge <= 0 {
+		return false
+	}
+	imgCfg, _, err := image.DecodeConfig(source)
+	source.Seek(0, io.SeekStart)
+	if err != nil {
+		return false
+	}
+	return imgCfg.Width > cfg.PhotoMaxEdge || imgCfg.Height > cfg.PhotoMaxEdge
+}
 
-				err = jpeg.Encode(copy, img, &options)
-				if err != nil {
-					log.Fatalf("图片编码失败: %v", err)
-				}
-			}
+// applyGPSPrivacy 按用户的隐私设置删除或模糊EXIF中的GPS信息
+func applyGPSPrivacy(x *exifEditor, cfg *config.UserConfig) {
+	switch cfg.PhotoGPS {
+	case config.PhotoGPS_Strip:
+		x.stripGPS()
+	case config.PhotoGPS_Coarsen:
+		x.coarsenGPS(cfg.GPSPrecision)
+	}
+}
+
+// carryExif 将原照片的EXIF段写入重新编码后的JPEG数据。重新编码时像素已按方向值摆正，
+// 因此将方向值重置为1，并将图像宽高改为实际宽高，同时按隐私设置处理GPS信息。原照片没有EXIF时原样返回
+func carryExif(original []byte, encoded []byte, width int, height int, cfg *config.UserConfig) []byte {
+	seg := exifSegment(original)
+	if seg == nil {
+		return encoded
+	}
+	if x, err := newExifEditor(seg); err == nil {
+		x.resetOrientation()
+		x.setDimensions(width, height)
+		applyGPSPrivacy(x, cfg)
+	}
+	return insertExifSegment(encoded, seg)
+}
 
-			copy.Close()
-			source.Close()
+// movePhoto 转存照片文件到指定目录下（不会删除原照片），隐藏标记点的照片也会转存。
+// 转存目录中已有内容相同的文件时不再重复保存，改为引用已有文件。
+// 返回以此去重的照片数量、转存成功并通过校验的原照片路径，以及转存失败的照片及原因
+func (t *TravelData) movePhoto(basePath string, cfg *config.UserConfig) (deduplicated int, verified []string, failed []string) {
+	if !cfg.MovePhoto {
+		return 0, nil, nil
+	}
+	copyPath := copyDir(basePath, cfg)
+	if err := os.MkdirAll(copyPath, 0755); err != nil {
+		return 0, nil, []string{fmt.Sprintf("%s：%v", copyPath, err)}
+	}
+	index := newCopyIndex(copyPath)
+	//转存一张照片，已有相同内容的文件时返回该文件名。转存并校验成功后才记为可以删除
+	save := func(src string, copyName string, orientation int) string {
+		data, err := photoBytes(src, orientation, cfg)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s：%v", filepath.Base(src), err))
+			return copyName
+		}
+		//已有文件的内容在查找时读取并比对过，无需再次校验。
+		//转存目录与导入目录相同时，找到的可能就是原照片本身，此时不能删除
+		if existing, ok := index.find(data); ok {
+			deduplicated++
+			if !sameFile(src, filepath.Join(copyPath, filepath.FromSlash(existing))) {
+				verified = append(verified, src)
+			}
+			return existing
+		}
+		dst := filepath.Join(copyPath, filepath.FromSlash(copyName))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			failed = append(failed, fmt.Sprintf("%s：%v", filepath.Base(src), err))
+			return copyName
+		}
+		recordWrite(dst)
+		if err := writeFileSync(dst, data); err != nil {
+			os.Remove(dst) //不保留写了一半的文件
+			failed = append(failed, fmt.Sprintf("%s：%v", filepath.Base(src), err))
+			return copyName
 		}
+		if err := copyVerified(dst, data); err != nil {
+			failed = append(failed, fmt.Sprintf("%s：%v", filepath.Base(src), err))
+			return copyName
+		}
+		index.add(copyName, data)
+		verified = append(verified, src)
+		return copyName
+	}
+	for i := range pData.validPhotos {
+		pData.copyNames[i] = save(t.photoSource(i), pData.copyNames[i], pData.orientation[i])
 	}
+	for i := range pData.hiddenPhotos {
+		h := &pData.hiddenPhotos[i]
+		h.copyName = save(t.sourcePath(h.source, h.name), h.copyName, h.orientation)
+	}
+	return deduplicated, verified, failed
 }
 
-// deletePhoto 删除原照片
-func (t *TravelData) deletePhoto(cfg *config.UserConfig) {
-	if cfg.MovePhoto {
-		if cfg.DeletePhoto {
-			for _, fileName := range pData.validPhotos {
-				os.Remove(filepath.Join(t.InputPath, fileName))
+// writeFileSync 将数据写入文件，并刷新缓冲区确保成功保存
+func writeFileSync(path string, data []byte) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// photoBytes 按用户设置生成转存后的照片数据：质量为100且无需缩小时保持原样，只按隐私设置处理GPS信息；否则压缩照片
+func photoBytes(src string, orientation int, cfg *config.UserConfig) ([]byte, error) {
+	source, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	reencode := needReencode(source, cfg)
+	data, err := io.ReadAll(source)
+	if err != nil {
+		return nil, err
+	}
+	if !reencode { //不压缩时原地修改EXIF中的GPS信息
+		if cfg.PhotoGPS != config.PhotoGPS_Keep {
+			if start, end, ok := exifSegmentPos(data); ok {
+				if x, err := newExifEditor(data[start:end]); err == nil {
+					applyGPSPrivacy(x, cfg)
+				}
 			}
 		}
+		return data, nil
+	}
+
+	//压缩图片
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	//缩小到最大长边以内，并按EXIF方向值摆正
+	img = applyOrientation(resizeImage(img, cfg.PhotoMaxEdge), orientation)
+
+	//JPEG编码选项
+	options := jpeg.Options{
+		Quality: cfg.PhotoQuality,
+	}
+
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, img, &options)
+	if err != nil {
+		return nil, err
+	}
+
+	//jpeg.Encode不会写入EXIF，按用户设置将原照片的EXIF写回
+	out := buf.Bytes()
+	if cfg.KeepEXIF {
+		out = carryExif(data, out, img.Bounds().Dx(), img.Bounds().Dy(), cfg)
+	}
+	return out, nil
+}
+
+// deletePhoto 删除原照片。只删除转存成功并通过校验的照片，且不直接删除，而是移到暂存目录或回收站，可以恢复。
+// 返回移走的照片和无法删除的照片及原因
+func (t *TravelData) deletePhoto(verified []string, cfg *config.UserConfig) ([]deletedPhoto, []string) {
+	if cfg.MovePhoto && cfg.DeletePhoto && len(verified) > 0 {
+		return recyclePhotos(verified, cfg)
 	}
+	return nil, nil
 }
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"testing"
+	"time"
+)
+
+func TestCoarsenLocations(t *testing.T) {
+	setPhotos([]string{"a.jpg", "b.jpg"}, []string{"", ""})
+	pData.rawLocation = []location{{39.907345, 116.391234}, {39.912345, 116.401234}}
+	pData.convertedLocation = []location{{39.908745, 116.397434}, {39.913745, 116.407434}}
+	pData.centerLocation = location{39.911245, 116.402434}
+	pData.existingMarkers = []existingMarker{{photo: "c.jpg", loc: location{39.921234, 116.411234}}}
+
+	coarsenLocations(&config.UserConfig{CoarsenMarkers: false, GPSPrecision: 2})
+	if pData.rawLocation[0].lat != 39.907345 {
+		t.Fatalf("未开启时不应修改坐标")
+	}
+
+	coarsenLocations(&config.UserConfig{CoarsenMarkers: true, GPSPrecision: 2})
+	want := []location{{39.91, 116.39}, {39.91, 116.40}}
+	for i := range want {
+		if pData.rawLocation[i] != want[i] {
+			t.Errorf("第%d张照片的原始坐标为%v，应为%v", i+1, pData.rawLocation[i], want[i])
+		}
+	}
+	if pData.convertedLocation[1] != (location{39.91, 116.41}) || pData.existingMarkers[0].loc != (location{39.92, 116.41}) {
+		t.Errorf("高德坐标为%v，已有标记点坐标为%v", pData.convertedLocation[1], pData.existingMarkers[0].loc)
+	}
+	//地图中心按模糊后的照片和已有标记点坐标重新计算，也会被模糊
+	if pData.centerLocation != (location{39.91, 116.41}) {
+		t.Errorf("地图中心为%v", pData.centerLocation)
+	}
+}
+
+func TestParseClockOffset(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", 0, true},
+		{" -1h ", -time.Hour, true},
+		{"+8h30m", 8*time.Hour + 30*time.Minute, true},
+		{"1天", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseClockOffset(tt.in)
+		if got != tt.want || (err == nil) != tt.wantOK {
+			t.Errorf("parseClockOffset(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// place 逆地理编码得到的地点信息
+type place struct {
+	Country  string `json:"country"`  //国家
+	Province string `json:"province"` //省份
+	City     string `json:"city"`     //城市
+	District string `json:"district"` //区县
+	POI      string `json:"poi"`      //最近的兴趣点
+}
+
+// 逆地理编码缓存文件，与配置文件放在同一目录下
+const geocodeCacheFile = "geocode_cache.json"
+
+// 高德逆地理编码接口路径
+const amapRegeoPath = "/v3/geocode/regeo"
+
+// amapRegeoResp 高德逆地理编码接口的返回值
+type amapRegeoResp struct {
+	Status    string `json:"status"`
+	Info      string `json:"info"`
+	Regeocode struct {
+		AddressComponent struct {
+			Country  json.RawMessage `json:"country"`
+			Province json.RawMessage `json:"province"`
+			City     json.RawMessage `json:"city"`
+			District json.RawMessage `json:"district"`
+		} `json:"addressComponent"`
+		Pois []struct {
+			Name string `json:"name"`
+		} `json:"pois"`
+	} `json:"regeocode"`
+}
+
+// amapString 解析高德接口中可能为字符串或空数组的字段，如直辖市的city为[]
+func amapString(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) != nil {
+		return ""
+	}
+	return s
+}
+
+// amapBaseURL 获取高德接口地址，未设置时使用高德官方地址
+func amapBaseURL(cfg *config.UserConfig) string {
+	base := strings.TrimRight(cfg.AmapBaseURL, "/")
+	if base == "" {
+		return config.DefaultAmapBaseURL
+	}
+	return base
+}
+
+// geocodeCacheKey 逆地理编码缓存的键，精确到小数点后5位（约1米）
+func geocodeCacheKey(loc location) string {
+	return fmt.Sprintf("%.5f,%.5f", loc.long, loc.lat)
+}
+
+// loadGeocodeCache 读取逆地理编码缓存，文件不存在或损坏时返回空缓存
+func loadGeocodeCache() map[string]place {
+	cache := make(map[string]place)
+	data, err := os.ReadFile(statePath(geocodeCacheFile))
+	if err != nil {
+		return cache
+	}
+	json.Unmarshal(data, &cache)
+	return cache
+}
+
+// saveGeocodeCache 保存逆地理编码缓存
+func saveGeocodeCache(cache map[string]place) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(statePath(geocodeCacheFile), data, 0644)
+}
+
+// amapRegeo 调用高德逆地理编码接口，获取高德坐标loc所在的地点信息
+func amapRegeo(client *http.Client, loc location, cfg *config.UserConfig) (place, error) {
+	query := url.Values{}
+	query.Set("key", cfg.Key)
+	query.Set("location", fmt.Sprintf("%f,%f", loc.long, loc.lat))
+	query.Set("extensions", "all")
+	query.Set("radius", "200")
+	query.Set("output", "json")
+
+	resp, err := client.Get(amapBaseURL(cfg) + amapRegeoPath + "?" + query.Encode())
+	if err != nil {
+		return place{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return place{}, err
+	}
+	var r amapRegeoResp
+	if err := json.Unmarshal(body, &r); err != nil {
+		return place{}, err
+	}
+	if r.Status != "1" {
+		return place{}, fmt.Errorf("高德接口返回错误：%s", r.Info)
+	}
+
+	p := place{
+		Country:  amapString(r.Regeocode.AddressComponent.Country),
+		Province: amapString(r.Regeocode.AddressComponent.Province),
+		City:     amapString(r.Regeocode.AddressComponent.City),
+		District: amapString(r.Regeocode.AddressComponent.District),
+	}
+	//直辖市没有city，使用省份名
+	if p.City == "" {
+		p.City = p.Province
+	}
+	if len(r.Regeocode.Pois) > 0 {
+		p.POI = r.Regeocode.Pois[0].Name
+	}
+	return p, nil
+}
+
+// reverseGeocode 按用户设置对所有有效照片进行逆地理编码，结果保存到pData.places。返回编码失败的照片名
+func (t *TravelData) reverseGeocode(cfg *config.UserConfig) []string {
+	pData.places = make([]place, len(pData.validPhotos))
+	switch cfg.Geocoder {
+	case config.Geocoder_Amap:
+		return amapGeocode(cfg)
+	case config.Geocoder_Offline:
+		return offlineGeocode(cfg)
+	}
+	return nil
+}
+
+// offlineGeocode 使用本地数据集进行逆地理编码。数据集坐标为WGS-84，因此使用照片原始坐标
+func offlineGeocode(cfg *config.UserConfig) []string {
+	g, err := loadOfflineGeocoder(cfg.GeoDataPath)
+	if err != nil {
+		return append([]string(nil), pData.validPhotos...)
+	}
+	var failed []string
+	for i, loc := range pData.rawLocation {
+		p, err := g.lookup(loc)
+		if err != nil {
+			failed = append(failed, pData.validPhotos[i])
+			continue
+		}
+		pData.places[i] = p
+	}
+	return failed
+}
+
+// amapGeocode 使用高德逆地理编码接口进行逆地理编码，结果会缓存到本地
+func amapGeocode(cfg *config.UserConfig) []string {
+	var failed []string
+	cache := loadGeocodeCache()
+	client := &http.Client{Timeout: 10 * time.Second}
+	for i, loc := range pData.convertedLocation {
+		key := geocodeCacheKey(loc)
+		if p, ok := cache[key]; ok {
+			pData.places[i] = p
+			continue
+		}
+		p, err := amapRegeo(client, loc, cfg)
+		if err != nil {
+			failed = append(failed, pData.validPhotos[i])
+			continue
+		}
+		cache[key] = p
+		pData.places[i] = p
+	}
+	saveGeocodeCache(cache)
+	return failed
+}
+
+// visited 按拍摄时间先后，返回所有照片地点中不重复的字段值，如到访过的城市。更新模式下包括已有标记点中的地点
+func visited(field func(p place) string) []string {
+	type visit struct {
+		date  string
+		place place
+	}
+	var visits []visit
+	for i := range pData.places {
+		visits = append(visits, visit{pData.date[i], pData.places[i]})
+	}
+	for _, m := range pData.existingMarkers {
+		visits = append(visits, visit{m.date, m.place})
+	}
+	//有拍摄时间的照片按时间排序，没有拍摄时间的排在最后
+	sort.SliceStable(visits, func(a, b int) bool {
+		ta, okA := parsePhotoTime(visits[a].date)
+		tb, okB := parsePhotoTime(visits[b].date)
+		if okA != okB {
+			return okA
+		}
+		return okA && ta.Before(tb)
+	})
+
+	var result []string
+	seen := make(map[string]bool)
+	for _, v := range visits {
+		value := field(v.place)
+		if value != "" && !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// yamlValue 在字符串包含YAML特殊字符时为其加上引号
+func yamlValue(s string) string {
+	if s == "" || strings.ContainsAny(s, `:#[]{},&*!|>'"%@`+"`") || strings.TrimSpace(s) != s {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
@@ -0,0 +1,423 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 离线数据集的默认位置，与配置文件放在同一目录下
+const defaultGeoDataPath = "geodata"
+
+// GeoNames附带的行政区名称文件，不是城市数据
+const (
+	geoNamesAdmin1File  = "admin1CodesASCII.txt"
+	geoNamesCountryFile = "countryInfo.txt"
+)
+
+// 离线城市匹配的最大距离，单位米。超出该距离时不认为照片位于该城市
+const maxCityDistance = 50000
+
+// 空间索引网格的边长，单位度
+const gridCellSize = 1.0
+
+// gridCell 空间索引网格的坐标
+type gridCell struct {
+	x, y int
+}
+
+// cellOf 获取经纬度所在的网格
+func cellOf(lat, long float64) gridCell {
+	return gridCell{int(math.Floor(long / gridCellSize)), int(math.Floor(lat / gridCellSize))}
+}
+
+// boundary 行政区边界
+type boundary struct {
+	level    string         //行政级别：country、province、city、district
+	name     string         //行政区名称
+	country  string         //所属国家，可能为空
+	polygons [][][]location //多边形列表，每个多边形的第一个环为外环，其余为内环
+	min, max location       //外包矩形
+}
+
+// city GeoNames中的城市
+type city struct {
+	name     string
+	province string
+	country  string
+	loc      location
+}
+
+// offlineGeocoder 基于本地数据集的逆地理编码器
+type offlineGeocoder struct {
+	boundaries    []boundary
+	boundaryIndex map[gridCell][]int //网格到与其相交的边界的映射
+	cities        []city
+	cityIndex     map[gridCell][]int //网格到位于其中的城市的映射
+}
+
+// 已加载的离线数据集，避免每次生成都重新读取
+var (
+	offlineMu    sync.Mutex
+	offlineCache = make(map[string]*offlineGeocoder)
+)
+
+// loadOfflineGeocoder 读取离线数据集。path可以是单个文件，也可以是存放数据文件的文件夹，为空时使用默认位置。
+// 支持行政区边界GeoJSON（.geojson/.json）和GeoNames城市数据（.txt）
+func loadOfflineGeocoder(path string) (*offlineGeocoder, error) {
+	if path == "" {
+		path = defaultGeoDataPath
+	}
+	path = statePath(path)
+	offlineMu.Lock()
+	defer offlineMu.Unlock()
+	if g, ok := offlineCache[path]; ok {
+		return g, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("未找到离线数据集：%w", err)
+	}
+	files := []string{path}
+	dir := filepath.Dir(path)
+	if info.IsDir() {
+		dir = path
+		files, _ = filepath.Glob(filepath.Join(path, "*"))
+	}
+
+	g := &offlineGeocoder{
+		boundaryIndex: make(map[gridCell][]int),
+		cityIndex:     make(map[gridCell][]int),
+	}
+	admin1 := readGeoNamesNames(filepath.Join(dir, geoNamesAdmin1File), 0, 1)
+	countries := readGeoNamesNames(filepath.Join(dir, geoNamesCountryFile), 0, 4)
+	for _, file := range files {
+		switch base := filepath.Base(file); {
+		case base == geoNamesAdmin1File || base == geoNamesCountryFile:
+			continue
+		case strings.HasSuffix(strings.ToLower(base), ".geojson") || strings.HasSuffix(strings.ToLower(base), ".json"):
+			err = g.loadBoundaries(file)
+		case strings.HasSuffix(strings.ToLower(base), ".txt"):
+			err = g.loadGeoNames(file, admin1, countries)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取%s失败：%w", filepath.Base(file), err)
+		}
+	}
+	if len(g.boundaries) == 0 && len(g.cities) == 0 {
+		return nil, errors.New("离线数据集中没有可用的数据")
+	}
+
+	offlineCache[path] = g
+	return g, nil
+}
+
+// readGeoNamesNames 读取GeoNames的名称对照文件，以第keyCol列为键、第nameCol列为值。文件不存在时返回空表
+func readGeoNamesNames(path string, keyCol int, nameCol int) map[string]string {
+	names := make(map[string]string)
+	file, err := os.Open(path)
+	if err != nil {
+		return names
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		cols := strings.Split(line, "\t")
+		if len(cols) > max(keyCol, nameCol) {
+			names[cols[keyCol]] = cols[nameCol]
+		}
+	}
+	return names
+}
+
+// loadGeoNames 读取GeoNames城市数据（如cities500.txt），并建立网格索引
+func (g *offlineGeocoder) loadGeoNames(path string, admin1 map[string]string, countries map[string]string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		//各列依次为：geonameid、name、asciiname、alternatenames、latitude、longitude、feature class、
+		//feature code、country code、cc2、admin1 code……
+		cols := strings.Split(scanner.Text(), "\t")
+		if len(cols) < 11 {
+			continue
+		}
+		lat, err1 := strconv.ParseFloat(cols[4], 64)
+		long, err2 := strconv.ParseFloat(cols[5], 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		c := city{
+			name:     cols[1],
+			province: admin1[cols[8]+"."+cols[10]],
+			country:  cols[8],
+			loc:      location{lat, long},
+		}
+		if name, ok := countries[cols[8]]; ok {
+			c.country = name
+		}
+		cell := cellOf(lat, long)
+		g.cityIndex[cell] = append(g.cityIndex[cell], len(g.cities))
+		g.cities = append(g.cities, c)
+	}
+	return scanner.Err()
+}
+
+// boundaryLevel 根据要素属性判断行政级别。支持level（country/province/city/district）和OSM的admin_level
+func boundaryLevel(properties map[string]interface{}) string {
+	if level, ok := properties["level"].(string); ok {
+		switch level {
+		case "country", "province", "city", "district":
+			return level
+		}
+	}
+	var adminLevel float64
+	switch v := properties["admin_level"].(type) {
+	case float64:
+		adminLevel = v
+	case string:
+		adminLevel, _ = strconv.ParseFloat(v, 64)
+	}
+	switch {
+	case adminLevel == 2:
+		return "country"
+	case adminLevel >= 3 && adminLevel <= 4:
+		return "province"
+	case adminLevel >= 5 && adminLevel <= 6:
+		return "city"
+	case adminLevel >= 7 && adminLevel <= 8:
+		return "district"
+	}
+	//Natural Earth的一级行政区数据带有所属国家admin字段
+	if _, ok := properties["admin"]; ok {
+		return "province"
+	}
+	return ""
+}
+
+// propertyString 获取要素属性中第一个存在的字符串字段
+func propertyString(properties map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if v, ok := properties[key].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseRing 将GeoJSON坐标数组解析为环
+func parseRing(raw [][]float64) []location {
+	ring := make([]location, 0, len(raw))
+	for _, c := range raw {
+		if len(c) >= 2 {
+			ring = append(ring, location{lat: c[1], long: c[0]})
+		}
+	}
+	return ring
+}
+
+// loadBoundaries 读取行政区边界GeoJSON，并建立网格索引
+func (g *offlineGeocoder) loadBoundaries(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var fc struct {
+		Features []struct {
+			Geometry struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return err
+	}
+
+	for _, f := range fc.Features {
+		b := boundary{
+			level:   boundaryLevel(f.Properties),
+			name:    propertyString(f.Properties, "name", "NAME", "name_zh"),
+			country: propertyString(f.Properties, "country", "admin", "ADMIN"),
+		}
+		if b.level == "" || b.name == "" {
+			continue
+		}
+		//解析多边形
+		switch f.Geometry.Type {
+		case "Polygon":
+			var rings [][][]float64
+			if json.Unmarshal(f.Geometry.Coordinates, &rings) != nil {
+				continue
+			}
+			var polygon [][]location
+			for _, r := range rings {
+				polygon = append(polygon, parseRing(r))
+			}
+			b.polygons = append(b.polygons, polygon)
+		case "MultiPolygon":
+			var polys [][][][]float64
+			if json.Unmarshal(f.Geometry.Coordinates, &polys) != nil {
+				continue
+			}
+			for _, rings := range polys {
+				var polygon [][]location
+				for _, r := range rings {
+					polygon = append(polygon, parseRing(r))
+				}
+				b.polygons = append(b.polygons, polygon)
+			}
+		default:
+			continue
+		}
+		//计算外包矩形
+		b.min = location{math.Inf(1), math.Inf(1)}
+		b.max = location{math.Inf(-1), math.Inf(-1)}
+		for _, polygon := range b.polygons {
+			if len(polygon) == 0 {
+				continue
+			}
+			for _, p := range polygon[0] {
+				b.min.lat, b.min.long = math.Min(b.min.lat, p.lat), math.Min(b.min.long, p.long)
+				b.max.lat, b.max.long = math.Max(b.max.lat, p.lat), math.Max(b.max.long, p.long)
+			}
+		}
+		if math.IsInf(b.min.lat, 0) {
+			continue
+		}
+		//将边界登记到与外包矩形相交的所有网格中
+		idx := len(g.boundaries)
+		g.boundaries = append(g.boundaries, b)
+		minCell, maxCell := cellOf(b.min.lat, b.min.long), cellOf(b.max.lat, b.max.long)
+		for x := minCell.x; x <= maxCell.x; x++ {
+			for y := minCell.y; y <= maxCell.y; y++ {
+				g.boundaryIndex[gridCell{x, y}] = append(g.boundaryIndex[gridCell{x, y}], idx)
+			}
+		}
+	}
+	return nil
+}
+
+// inRing 射线法判断点是否位于环内
+func inRing(p location, ring []location) bool {
+	in := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a.lat > p.lat) != (b.lat > p.lat) &&
+			p.long < (b.long-a.long)*(p.lat-a.lat)/(b.lat-a.lat)+a.long {
+			in = !in
+		}
+	}
+	return in
+}
+
+// contains 判断点是否位于行政区边界内
+func (b *boundary) contains(p location) bool {
+	if p.lat < b.min.lat || p.lat > b.max.lat || p.long < b.min.long || p.long > b.max.long {
+		return false
+	}
+	for _, polygon := range b.polygons {
+		if len(polygon) == 0 || !inRing(p, polygon[0]) {
+			continue
+		}
+		inHole := false
+		for _, hole := range polygon[1:] {
+			if inRing(p, hole) {
+				inHole = true
+				break
+			}
+		}
+		if !inHole {
+			return true
+		}
+	}
+	return false
+}
+
+// distance 计算两点间的球面距离，单位米
+func distance(a location, b location) float64 {
+	const earthRadius = 6371000
+	rad := math.Pi / 180
+	dLat := (b.lat - a.lat) * rad
+	dLong := (b.long - a.long) * rad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(a.lat*rad)*math.Cos(b.lat*rad)*math.Sin(dLong/2)*math.Sin(dLong/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// nearestCity 在照片周围的网格中查找距离最近的城市，超出最大距离时返回false
+func (g *offlineGeocoder) nearestCity(p location) (city, bool) {
+	var best city
+	bestDist := math.Inf(1)
+	center := cellOf(p.lat, p.long)
+	for x := center.x - 1; x <= center.x+1; x++ {
+		for y := center.y - 1; y <= center.y+1; y++ {
+			for _, i := range g.cityIndex[gridCell{x, y}] {
+				if d := distance(p, g.cities[i].loc); d < bestDist {
+					best, bestDist = g.cities[i], d
+				}
+			}
+		}
+	}
+	return best, bestDist <= maxCityDistance
+}
+
+// lookup 查找WGS-84坐标p所在的国家、省份、城市和区县
+func (g *offlineGeocoder) lookup(p location) (place, error) {
+	var result place
+	for _, i := range g.boundaryIndex[cellOf(p.lat, p.long)] {
+		b := &g.boundaries[i]
+		if !b.contains(p) {
+			continue
+		}
+		switch b.level {
+		case "country":
+			result.Country = b.name
+		case "province":
+			result.Province = b.name
+		case "city":
+			result.City = b.name
+		case "district":
+			result.District = b.name
+		}
+		if result.Country == "" {
+			result.Country = b.country
+		}
+	}
+	//边界数据中没有城市时，用最近的GeoNames城市补全
+	if c, ok := g.nearestCity(p); ok {
+		if result.City == "" {
+			result.City = c.name
+		}
+		if result.Province == "" {
+			result.Province = c.province
+		}
+		if result.Country == "" {
+			result.Country = c.country
+		}
+	}
+	if result == (place{}) {
+		return result, errors.New("离线数据集中没有照片所在地")
+	}
+	return result, nil
+}
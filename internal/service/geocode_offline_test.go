@@ -0,0 +1,144 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// 测试用的离线数据集：一个带内环的省份边界、一个城市边界和三个GeoNames城市
+var testGeoData = map[string]string{
+	"boundaries.geojson": `{"type":"FeatureCollection","features":[
+{"type":"Feature","properties":{"level":"province","name":"测试省","country":"测试国"},"geometry":{"type":"Polygon","coordinates":[
+[[100,20],[110,20],[110,30],[100,30],[100,20]],
+[[108,28],[109,28],[109,29],[108,29],[108,28]]]}},
+{"type":"Feature","properties":{"admin_level":"6","name":"边界市"},"geometry":{"type":"MultiPolygon","coordinates":[
+[[[101,21],[102,21],[102,22],[101,22],[101,21]]]]}},
+{"type":"Feature","properties":{"name":"无级别"},"geometry":{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]}}]}`,
+	"cities500.txt": "1\t城市甲\tA\t\t25.0\t105.0\tP\tPPL\tXX\t\t01\n" +
+		"3\t城市丙\tC\t\t25.0\t99.5\tP\tPPL\tXX\t\t01\n" +
+		"2\t城市乙\tB\t\t45.0\t120.0\tP\tPPL\tYY\t\t02\n" +
+		"坏行\n",
+	geoNamesAdmin1File:  "XX.01\t甲省\tJia\t1\n",
+	geoNamesCountryFile: "#ISO\tISO3\tISO-Numeric\tfips\tCountry\nXX\tXXX\t000\tXX\t甲国\n",
+}
+
+// writeGeoData 在临时目录中写入测试用的离线数据集
+func writeGeoData(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range testGeoData {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestOfflineLookup(t *testing.T) {
+	g, err := loadOfflineGeocoder(writeGeoData(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.boundaries) != 2 || len(g.cities) != 3 {
+		t.Fatalf("读取到%d个边界、%d个城市", len(g.boundaries), len(g.cities))
+	}
+	tests := []struct {
+		name    string
+		loc     location
+		want    place
+		wantErr bool
+	}{
+		{"位于城市边界内", location{21.5, 101.5}, place{Country: "测试国", Province: "测试省", City: "边界市"}, false},
+		{"城市由最近的GeoNames城市补全", location{25.1, 105.1}, place{Country: "测试国", Province: "测试省", City: "城市甲"}, false},
+		{"位于省份的内环中", location{28.5, 108.5}, place{}, true},
+		{"只有GeoNames城市，国家和省份使用名称对照", location{25.0, 99.6}, place{Country: "甲国", Province: "甲省", City: "城市丙"}, false},
+		{"没有国家名称对照时使用国家代码", location{45.1, 120.1}, place{Country: "YY", City: "城市乙"}, false},
+		{"超出最大距离", location{-30, -60}, place{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := g.lookup(tt.loc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("错误为%v", err)
+			}
+			if got != tt.want {
+				t.Errorf("得到%+v，应为%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadOfflineGeocoder(t *testing.T) {
+	dir := writeGeoData(t)
+	//单个文件
+	g, err := loadOfflineGeocoder(filepath.Join(dir, "boundaries.geojson"))
+	if err != nil || len(g.boundaries) != 2 || len(g.cities) != 0 {
+		t.Errorf("只读取指定文件：%v", err)
+	}
+	//同一路径只读取一次
+	if again, _ := loadOfflineGeocoder(filepath.Join(dir, "boundaries.geojson")); again != g {
+		t.Errorf("已加载的数据集应被复用")
+	}
+	if _, err := loadOfflineGeocoder(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("数据集不存在时应返回错误")
+	}
+	empty := t.TempDir()
+	os.WriteFile(filepath.Join(empty, "readme.md"), []byte("说明"), 0644)
+	if _, err := loadOfflineGeocoder(empty); err == nil {
+		t.Errorf("没有可用数据时应返回错误")
+	}
+}
+
+func TestBoundaryLevel(t *testing.T) {
+	tests := []struct {
+		properties map[string]interface{}
+		want       string
+	}{
+		{map[string]interface{}{"level": "city"}, "city"},
+		{map[string]interface{}{"level": "town", "admin_level": 8.0}, "district"},
+		{map[string]interface{}{"admin_level": "2"}, "country"},
+		{map[string]interface{}{"admin_level": 4.0}, "province"},
+		{map[string]interface{}{"admin": "China"}, "province"},
+		{map[string]interface{}{"admin_level": 10.0}, ""},
+	}
+	for _, tt := range tests {
+		if got := boundaryLevel(tt.properties); got != tt.want {
+			t.Errorf("boundaryLevel(%v) = %q，应为%q", tt.properties, got, tt.want)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	//赤道上经度相差1度约111.2公里
+	if d := distance(location{0, 0}, location{0, 1}); math.Abs(d-111195) > 10 {
+		t.Errorf("距离为%f米", d)
+	}
+	if d := distance(location{39.9, 116.3}, location{39.9, 116.3}); d != 0 {
+		t.Errorf("同一点距离应为0：%f", d)
+	}
+}
+
+func TestOfflineGeocode(t *testing.T) {
+	setPhotos([]string{"a.jpg", "b.jpg"}, []string{"", ""})
+	pData.rawLocation = []location{{21.5, 101.5}, {-30, -60}}
+	//离线编码使用WGS-84坐标
+	pData.convertedLocation = []location{{0, 0}, {0, 0}}
+	td := &TravelData{}
+	cfg := &config.UserConfig{Geocoder: config.Geocoder_Offline, GeoDataPath: writeGeoData(t)}
+	if failed := td.reverseGeocode(cfg); !reflect.DeepEqual(failed, []string{"b.jpg"}) {
+		t.Errorf("编码失败的照片为%v", failed)
+	}
+	if pData.places[0].City != "边界市" {
+		t.Errorf("地点为%+v", pData.places[0])
+	}
+
+	//数据集无法读取时所有照片都编码失败
+	cfg.GeoDataPath = filepath.Join(t.TempDir(), "missing")
+	if failed := td.reverseGeocode(cfg); len(failed) != 2 {
+		t.Errorf("编码失败的照片为%v", failed)
+	}
+}
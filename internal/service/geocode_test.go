@@ -0,0 +1,141 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// chdirTemp 切换到临时目录，缓存等文件保存在当前目录下，测试结束后切换回原目录
+func chdirTemp(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func TestAmapRegeo(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    place
+		wantErr bool
+	}{
+		{"普通城市", `{"status":"1","regeocode":{"addressComponent":{"country":"中国","province":"浙江省","city":"杭州市","district":"西湖区"},"pois":[{"name":"断桥"},{"name":"白堤"}]}}`,
+			place{Country: "中国", Province: "浙江省", City: "杭州市", District: "西湖区", POI: "断桥"}, false},
+		{"直辖市的city为空数组", `{"status":"1","regeocode":{"addressComponent":{"province":"北京市","city":[],"district":"东城区"},"pois":[]}}`,
+			place{Province: "北京市", City: "北京市", District: "东城区"}, false},
+		{"境外没有地址", `{"status":"1","regeocode":{"addressComponent":{"province":[],"city":[],"district":[]}}}`,
+			place{}, false},
+		{"接口返回错误", `{"status":"0","info":"INVALID_USER_KEY"}`, place{}, true},
+		{"返回内容不是JSON", `<html>`, place{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var query string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				query = r.URL.Path + "?" + r.URL.RawQuery
+				fmt.Fprint(w, tt.body)
+			}))
+			defer srv.Close()
+
+			cfg := &config.UserConfig{Key: "k", AmapBaseURL: srv.URL + "/"}
+			got, err := amapRegeo(srv.Client(), location{30.25, 120.15}, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("错误为%v", err)
+			}
+			if got != tt.want {
+				t.Errorf("得到%+v，应为%+v", got, tt.want)
+			}
+			//接口地址末尾的斜杠会被去掉，坐标顺序为经度,纬度
+			if !strings.HasPrefix(query, amapRegeoPath+"?") || !strings.Contains(query, "location=120.150000%2C30.250000") {
+				t.Errorf("请求为%s", query)
+			}
+		})
+	}
+}
+
+func TestReverseGeocode(t *testing.T) {
+	chdirTemp(t)
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if strings.Contains(r.URL.RawQuery, "39.920000") {
+			fmt.Fprint(w, `{"status":"0","info":"DAILY_QUERY_OVER_LIMIT"}`)
+			return
+		}
+		fmt.Fprint(w, `{"status":"1","regeocode":{"addressComponent":{"province":"北京市","city":[],"district":"西城区"}}}`)
+	}))
+	defer srv.Close()
+	cfg := &config.UserConfig{Geocoder: config.Geocoder_Amap, AmapBaseURL: srv.URL}
+	td := &TravelData{}
+
+	setPhotos([]string{"a.jpg", "b.jpg", "c.jpg"}, []string{"", "", ""})
+	if failed := td.reverseGeocode(cfg); !reflect.DeepEqual(failed, []string{"c.jpg"}) {
+		t.Errorf("编码失败的照片为%v", failed)
+	}
+	if requests != 3 || pData.places[0].City != "北京市" || pData.places[2] != (place{}) {
+		t.Errorf("请求%d次，地点为%+v", requests, pData.places)
+	}
+
+	//再次编码时成功的结果从缓存读取，失败的重新请求
+	requests = 0
+	setPhotos([]string{"a.jpg", "b.jpg", "c.jpg"}, []string{"", "", ""})
+	td.reverseGeocode(cfg)
+	if requests != 1 || pData.places[1].District != "西城区" {
+		t.Errorf("请求%d次，应只请求缓存中没有的地点", requests)
+	}
+
+	//未开启时不请求，地点为空
+	requests = 0
+	td.reverseGeocode(&config.UserConfig{Geocoder: config.Geocoder_None, AmapBaseURL: srv.URL})
+	if requests != 0 || len(pData.places) != 3 || pData.places[0] != (place{}) {
+		t.Errorf("未开启逆地理编码时不应请求")
+	}
+}
+
+func TestVisited(t *testing.T) {
+	setPhotos([]string{"a.jpg", "b.jpg", "c.jpg", "d.jpg"},
+		[]string{"2024-05-02 10:00:00", "", "2024-05-01 10:00:00", "2024-05-03 10:00:00"})
+	pData.places = []place{{City: "杭州市"}, {City: "苏州市"}, {City: "上海市"}, {City: "杭州市"}}
+	//按拍摄时间去重，没有拍摄时间的排在最后
+	want := []string{"上海市", "杭州市", "苏州市"}
+	if got := visited(func(p place) string { return p.City }); !reflect.DeepEqual(got, want) {
+		t.Errorf("得到%v，应为%v", got, want)
+	}
+	//更新模式下合并已有标记点中的地点
+	pData.existingMarkers = []existingMarker{{date: "2024-04-30 10:00:00", place: place{City: "南京市"}}, {place: place{City: "无锡市"}}}
+	want = []string{"南京市", "上海市", "杭州市", "苏州市", "无锡市"}
+	if got := visited(func(p place) string { return p.City }); !reflect.DeepEqual(got, want) {
+		t.Errorf("得到%v，应为%v", got, want)
+	}
+}
+
+func TestYamlValue(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"杭州市", "杭州市"},
+		{"", `""`},
+		{"A: B", `"A: B"`},
+		{" 前后空格", `" 前后空格"`},
+		{"#1", `"#1"`},
+	}
+	for _, tt := range tests {
+		if got := yamlValue(tt.in); got != tt.want {
+			t.Errorf("yamlValue(%q) = %s，应为%s", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"fmt"
+	"math"
+)
+
+// hiddenPhoto 位于隐私区域内、只隐藏标记点的照片，不参与生成但仍按设置转存和删除
+type hiddenPhoto struct {
+	name        string //照片在导入目录中的相对路径
+	source      int    //照片来源的下标
+	date        string //拍摄时间
+	hash        string //照片短哈希
+	orientation int    //EXIF方向值
+	copyName    string //转存后的文件名
+}
+
+// geofenceOf 查找坐标所在的隐私区域，坐标不在任何区域内时返回false
+func geofenceOf(loc location, fences []config.Geofence) (config.Geofence, bool) {
+	for _, f := range fences {
+		if distance(loc, location{f.Lat, f.Long}) <= f.Radius {
+			return f, true
+		}
+	}
+	return config.Geofence{}, false
+}
+
+// wgs84ToGCJ02 在本地将WGS-84坐标近似转换为高德坐标（GCJ-02），误差在数米以内。中国境外的坐标不转换
+func wgs84ToGCJ02(loc location) location {
+	if loc.long < 72.004 || loc.long > 137.8347 || loc.lat < 0.8293 || loc.lat > 55.8271 {
+		return loc
+	}
+	const a = 6378245.0               //克拉索夫斯基椭球长半轴
+	const ee = 0.00669342162296594323 //椭球第一偏心率的平方
+	x, y := loc.long-105, loc.lat-35
+	dLat := -100 + 2*x + 3*y + 0.2*y*y + 0.1*x*y + 0.2*math.Sqrt(math.Abs(x)) +
+		(20*math.Sin(6*x*math.Pi)+20*math.Sin(2*x*math.Pi))*2/3 +
+		(20*math.Sin(y*math.Pi)+40*math.Sin(y/3*math.Pi))*2/3 +
+		(160*math.Sin(y/12*math.Pi)+320*math.Sin(y/30*math.Pi))*2/3
+	dLong := 300 + x + 2*y + 0.1*x*x + 0.1*x*y + 0.1*math.Sqrt(math.Abs(x)) +
+		(20*math.Sin(6*x*math.Pi)+20*math.Sin(2*x*math.Pi))*2/3 +
+		(20*math.Sin(x*math.Pi)+40*math.Sin(x/3*math.Pi))*2/3 +
+		(150*math.Sin(x/12*math.Pi)+300*math.Sin(x/30*math.Pi))*2/3
+	radLat := loc.lat / 180 * math.Pi
+	magic := 1 - ee*math.Sin(radLat)*math.Sin(radLat)
+	sqrtMagic := math.Sqrt(magic)
+	dLat = dLat * 180 / (a * (1 - ee) / (magic * sqrtMagic) * math.Pi)
+	dLong = dLong * 180 / (a / sqrtMagic * math.Cos(radLat) * math.Pi)
+	return location{loc.lat + dLat, loc.long + dLong}
+}
+
+// gcj02ToWgs84 在本地将高德坐标近似转换为WGS-84坐标，误差在数米以内
+func gcj02ToWgs84(loc location) location {
+	gcj := wgs84ToGCJ02(loc)
+	return location{2*loc.lat - gcj.lat, 2*loc.long - gcj.long}
+}
+
+// applyGeofences 将位于隐私区域内的照片从有效照片中移除，隐藏标记点模式下仍保留其转存所需的信息。
+// 返回被移除的照片及其所在区域。在坐标转换之前调用，隐私区域的圆心为高德坐标，
+// 因此先在本地将照片的原始坐标转换为高德坐标再比较，区域内照片的坐标不会发送给高德
+func applyGeofences(cfg *config.UserConfig) []string {
+	if len(cfg.Geofences) == 0 {
+		return nil
+	}
+	var removed []string
+	keep := make([]bool, len(pData.validPhotos))
+	for i, name := range pData.validPhotos {
+		f, ok := geofenceOf(wgs84ToGCJ02(pData.rawLocation[i]), cfg.Geofences)
+		if !ok {
+			keep[i] = true
+			continue
+		}
+		removed = append(removed, fmt.Sprintf("%s（%s）", name, f.Name))
+		//元数据表格中不写入隐私区域内照片的坐标和所在区域
+		if cfg.GeofenceMode != config.Geofence_HideMarker {
+			addFilteredPhoto(i, "排除", "位于隐私区域内", false)
+		} else {
+			addFilteredPhoto(i, "隐藏标记点", "位于隐私区域内", false)
+			pData.hiddenPhotos = append(pData.hiddenPhotos, hiddenPhoto{
+				name:        name,
+				source:      pData.source[i],
+				date:        pData.date[i],
+				hash:        photoHash(i),
+				orientation: pData.orientation[i],
+			})
+		}
+	}
+	keepPhotos(keep)
+	return removed
+}
+
+// keepPhotos 只保留keep为true的有效照片，同步更新读取EXIF时得到的各切片
+func keepPhotos(keep []bool) {
+	pData.validPhotos = filterSlice(pData.validPhotos, keep)
+	pData.source = filterSlice(pData.source, keep)
+	pData.rawLocation = filterSlice(pData.rawLocation, keep)
+	pData.convertedLocation = filterSlice(pData.convertedLocation, keep)
+	pData.device = filterSlice(pData.device, keep)
+	pData.altitude = filterSlice(pData.altitude, keep)
+	pData.orientation = filterSlice(pData.orientation, keep)
+	pData.date = filterSlice(pData.date, keep)
+}
+
+// filterSlice 返回只包含keep为true的元素的新切片
+func filterSlice[T any](s []T, keep []bool) []T {
+	result := make([]T, 0, len(s))
+	for i, v := range s {
+		if keep[i] {
+			result = append(result, v)
+		}
+	}
+	return result
+}
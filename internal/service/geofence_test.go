@@ -0,0 +1,99 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"MapPhotoMD/internal/model"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWgs84ToGCJ02(t *testing.T) {
+	tests := []struct {
+		name string
+		wgs  location
+		want location
+	}{
+		{"北京", location{39.90734, 116.39089}, location{39.90874, 116.39713}},
+		{"上海", location{31.22419, 121.46918}, location{31.22222, 121.47369}},
+		{"中国境外不转换", location{48.85, 2.35}, location{48.85, 2.35}},
+	}
+	for _, tt := range tests {
+		got := wgs84ToGCJ02(tt.wgs)
+		//高德坐标的偏移约为数百米，误差在1e-4度（约10米）以内即可用于判断隐私区域
+		if math.Abs(got.lat-tt.want.lat) > 1e-4 || math.Abs(got.long-tt.want.long) > 1e-4 {
+			t.Errorf("%s：得到%v，应为%v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApplyGeofences(t *testing.T) {
+	//圆心为高德坐标，与照片原始坐标相差约600米
+	home := config.Geofence{Name: "家", Lat: 39.90874, Long: 116.39713, Radius: 200}
+	tests := []struct {
+		name       string
+		mode       string
+		wantKept   []string
+		wantHidden int
+	}{
+		{"排除照片", config.Geofence_Exclude, []string{"away.jpg"}, 0},
+		{"只隐藏标记点", config.Geofence_HideMarker, []string{"away.jpg"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//在坐标转换之前调用，此时还没有高德坐标
+			pData = photoData{
+				validPhotos: []string{"home.jpg", "away.jpg"},
+				source:      []int{0, 0},
+				rawLocation: []location{{39.90734, 116.39089}, {39.95, 116.45}},
+				date:        []string{"", ""},
+				device:      []string{"", ""},
+				altitude:    []float64{0, 0},
+				orientation: []int{1, 1},
+			}
+			removed := applyGeofences(&config.UserConfig{Geofences: []config.Geofence{home}, GeofenceMode: tt.mode})
+			if !reflect.DeepEqual(removed, []string{"home.jpg（家）"}) {
+				t.Errorf("移除的照片为%v", removed)
+			}
+			if !reflect.DeepEqual(pData.validPhotos, tt.wantKept) || len(pData.rawLocation) != len(tt.wantKept) {
+				t.Errorf("保留的照片为%v", pData.validPhotos)
+			}
+			if len(pData.hiddenPhotos) != tt.wantHidden {
+				t.Errorf("隐藏标记点的照片有%d张，应为%d张", len(pData.hiddenPhotos), tt.wantHidden)
+			}
+		})
+	}
+}
+
+func TestDecodeEXIFSkipsGeofencedPhotos(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Query().Get("locations"))
+		fmt.Fprint(w, `{"status":"1","locations":"116.456,39.951"}`)
+	}))
+	defer srv.Close()
+
+	in := t.TempDir()
+	writeJPEG(t, in, "home.jpg", testPhoto{lat: 39.90734, long: 116.39089})
+	writeJPEG(t, in, "away.jpg", testPhoto{lat: 39.95, long: 116.45})
+	pData = photoData{}
+	td := &TravelData{Inputs: []*model.InputSourceData{{Path: in}}}
+	td.decodeEXIF(&config.UserConfig{
+		AmapBaseURL: srv.URL,
+		Geofences:   []config.Geofence{{Name: "家", Lat: 39.90874, Long: 116.39713, Radius: 200}},
+	})
+	//隐私区域内照片的坐标不应发送给高德
+	if len(requests) != 1 || !strings.HasPrefix(requests[0], "116.45") {
+		t.Errorf("坐标转换请求为%v", requests)
+	}
+	if !reflect.DeepEqual(pData.validPhotos, []string{"away.jpg"}) || len(pData.convertedLocation) != 1 {
+		t.Errorf("有效照片为%v", pData.validPhotos)
+	}
+	if !reflect.DeepEqual(pData.excluded, []string{"home.jpg（家）"}) {
+		t.Errorf("排除的照片为%v", pData.excluded)
+	}
+}
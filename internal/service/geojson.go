@@ -0,0 +1,170 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// geoJSONGeometry GeoJSON几何对象，坐标顺序为[经度,纬度]
+type geoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// geoJSONFeature GeoJSON要素
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// geoJSONFeatureCollection GeoJSON要素集合
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+// routePoint 路线上的一个点
+type routePoint struct {
+	time time.Time //拍摄时间
+	loc  location  //坐标
+}
+
+// 按天拆分路线时，第二天起依次使用的线条颜色
+var routePalette = []string{"#e6550d", "#31a354", "#756bb1", "#de2d26", "#3182bd", "#636363"}
+
+// 路线GeoJSON文件名
+const routeFileName = "route.geojson"
+
+// timeOrder 返回有拍摄时间的有效照片下标，按拍摄时间先后排序
+func timeOrder() []int {
+	var order []int
+	for i := range pData.validPhotos {
+		if _, ok := photoTime(i); ok {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ta, _ := photoTime(order[a])
+		tb, _ := photoTime(order[b])
+		return ta.Before(tb)
+	})
+	return order
+}
+
+// routePoints 按拍摄时间先后返回路线上的点，坐标与标记点一致，使用高德坐标。更新模式下包括已有的标记点
+func routePoints() []routePoint {
+	var points []routePoint
+	for _, i := range timeOrder() {
+		t, _ := photoTime(i)
+		points = append(points, routePoint{t, pData.convertedLocation[i]})
+	}
+	if len(pData.existingMarkers) == 0 {
+		return points
+	}
+	for _, m := range pData.existingMarkers {
+		if t, ok := parsePhotoTime(m.date); ok {
+			points = append(points, routePoint{t, m.loc})
+		}
+	}
+	sort.SliceStable(points, func(a, b int) bool {
+		return points[a].time.Before(points[b].time)
+	})
+	return points
+}
+
+// buildRoute 将路线点转换为GeoJSON要素集合。按天拆分时每天一条线，否则整段旅行一条线，少于两个点的线段会被忽略
+func buildRoute(points []routePoint, color string, splitByDay bool) geoJSONFeatureCollection {
+	fc := geoJSONFeatureCollection{Type: "FeatureCollection", Features: []geoJSONFeature{}}
+
+	//将路线点分组，每组对应一条线
+	var groups [][]routePoint
+	var names []string
+	for _, p := range points {
+		day := p.time.Format("2006-01-02")
+		if len(groups) == 0 || (splitByDay && names[len(names)-1] != day) {
+			groups = append(groups, nil)
+			names = append(names, day)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], p)
+	}
+
+	for i, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		coords := make([][2]float64, 0, len(group))
+		for _, p := range group {
+			coords = append(coords, [2]float64{p.loc.long, p.loc.lat})
+		}
+		stroke := color
+		if splitByDay && i > 0 {
+			stroke = routePalette[(i-1)%len(routePalette)]
+		}
+		properties := map[string]interface{}{
+			"stroke":       stroke,
+			"stroke-width": 3,
+		}
+		if splitByDay {
+			properties["name"] = names[i]
+		}
+		fc.Features = append(fc.Features, geoJSONFeature{
+			Type:       "Feature",
+			Geometry:   geoJSONGeometry{Type: "LineString", Coordinates: coords},
+			Properties: properties,
+		})
+	}
+	return fc
+}
+
+// writeGeoJSON 将GeoJSON要素集合写入文件
+func writeGeoJSON(path string, fc geoJSONFeatureCollection) error {
+	data, err := json.MarshalIndent(fc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(path, data)
+}
+
+// makeRoute 按用户设置生成旅行路线GeoJSON文件，生成成功时将文件名记录到pData.routeFile
+func (t *TravelData) makeRoute(basePath string, cfg *config.UserConfig) {
+	pData.routeFile = ""
+	if !cfg.DrawRoute {
+		return
+	}
+	fc := buildRoute(routePoints(), cfg.RouteColor, cfg.SplitRouteDay)
+	if len(fc.Features) == 0 { //有拍摄时间的照片不足，无法连成路线
+		return
+	}
+	if err := writeGeoJSON(filepath.Join(basePath, routeFileName), fc); err != nil {
+		return
+	}
+	pData.routeFile = routeFileName
+}
+
+// exportGeoJSON 将所有照片导出为GeoJSON点要素集合。按GeoJSON规范使用WGS-84坐标，高德坐标写在要素属性中
+func (t *TravelData) exportGeoJSON(basePath string, points []exportPoint) error {
+	fc := geoJSONFeatureCollection{Type: "FeatureCollection", Features: []geoJSONFeature{}}
+	for _, p := range points {
+		fc.Features = append(fc.Features, geoJSONFeature{
+			Type: "Feature",
+			Geometry: geoJSONGeometry{
+				Type:        "Point",
+				Coordinates: [2]float64{p.raw.long, p.raw.lat},
+			},
+			Properties: map[string]interface{}{
+				"name":       p.name,
+				"time":       p.date,
+				"device":     p.device,
+				"wgs84_lat":  p.raw.lat,
+				"wgs84_long": p.raw.long,
+				"gcj02_lat":  p.converted.lat,
+				"gcj02_long": p.converted.long,
+			},
+		})
+	}
+	return writeGeoJSON(filepath.Join(basePath, t.TravelName+".geojson"), fc)
+}
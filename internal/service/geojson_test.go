@@ -0,0 +1,165 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"MapPhotoMD/internal/model"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRoutePoints(t *testing.T) {
+	setPhotos([]string{"c.jpg", "nodate.jpg", "a.jpg", "b.jpg"},
+		[]string{"2024-05-02 09:00:00", "", "2024-05-01 10:00:00", "2024-05-01 18:00:00"})
+	points := routePoints()
+	if len(points) != 3 {
+		t.Fatalf("路线点有%d个，没有拍摄时间的照片不应加入路线", len(points))
+	}
+	for i, want := range []location{pData.convertedLocation[2], pData.convertedLocation[3], pData.convertedLocation[0]} {
+		if points[i].loc != want {
+			t.Errorf("第%d个路线点为%v，应为%v", i+1, points[i].loc, want)
+		}
+	}
+}
+
+func TestBuildRoute(t *testing.T) {
+	at := func(s string) time.Time {
+		t, _ := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		return t
+	}
+	points := []routePoint{
+		{at("2024-05-01 10:00"), location{39.90, 116.30}},
+		{at("2024-05-01 18:00"), location{39.91, 116.31}},
+		{at("2024-05-02 09:00"), location{39.92, 116.32}},
+		{at("2024-05-03 09:00"), location{39.93, 116.33}},
+		{at("2024-05-03 12:00"), location{39.94, 116.34}},
+	}
+	tests := []struct {
+		name       string
+		points     []routePoint
+		split      bool
+		wantLines  []int    //每条线的点数
+		wantColors []string //每条线的颜色
+		wantNames  []string //每条线的名称，不拆分时为空
+	}{
+		{"整段旅行一条线", points, false, []int{5}, []string{"#3388ff"}, []string{""}},
+		{"按天拆分，只有一个点的一天被忽略", points, true, []int{2, 2}, []string{"#3388ff", routePalette[1]}, []string{"2024-05-01", "2024-05-03"}},
+		{"不足两个点", points[:1], false, nil, nil, nil},
+		{"没有路线点", nil, true, nil, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc := buildRoute(tt.points, "#3388ff", tt.split)
+			if fc.Type != "FeatureCollection" || fc.Features == nil {
+				t.Fatalf("应返回要素集合，没有线时要素为空数组")
+			}
+			if len(fc.Features) != len(tt.wantLines) {
+				t.Fatalf("有%d条线，应为%d条", len(fc.Features), len(tt.wantLines))
+			}
+			for i, f := range fc.Features {
+				coords := f.Geometry.Coordinates.([][2]float64)
+				if f.Geometry.Type != "LineString" || len(coords) != tt.wantLines[i] {
+					t.Errorf("第%d条线有%d个点，应为%d个", i+1, len(coords), tt.wantLines[i])
+				}
+				if f.Properties["stroke"] != tt.wantColors[i] {
+					t.Errorf("第%d条线颜色为%v，应为%s", i+1, f.Properties["stroke"], tt.wantColors[i])
+				}
+				if name, _ := f.Properties["name"].(string); name != tt.wantNames[i] {
+					t.Errorf("第%d条线名称为%q，应为%q", i+1, name, tt.wantNames[i])
+				}
+				//GeoJSON坐标顺序为[经度,纬度]
+				if coords[0][0] < coords[0][1] {
+					t.Errorf("坐标顺序应为[经度,纬度]：%v", coords[0])
+				}
+			}
+		})
+	}
+}
+
+func TestMakeRoute(t *testing.T) {
+	setPhotos([]string{"a.jpg", "b.jpg"}, []string{"2024-05-01 10:00:00", "2024-05-01 11:00:00"})
+	td := &TravelData{TravelName: "trip"}
+
+	dir := t.TempDir()
+	td.makeRoute(dir, &config.UserConfig{DrawRoute: false})
+	if pData.routeFile != "" {
+		t.Errorf("未开启时不应生成路线")
+	}
+
+	td.makeRoute(dir, &config.UserConfig{DrawRoute: true, RouteColor: "#ff0000"})
+	if pData.routeFile != routeFileName {
+		t.Fatalf("开启时应生成路线")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, routeFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fc struct {
+		Features []struct {
+			Geometry struct {
+				Coordinates [][2]float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(data, &fc); err != nil {
+		t.Fatal(err)
+	}
+	if len(fc.Features) != 1 || len(fc.Features[0].Geometry.Coordinates) != 2 || fc.Features[0].Properties["stroke"] != "#ff0000" {
+		t.Errorf("路线文件内容错误：%s", data)
+	}
+
+	//有拍摄时间的照片不足两张时不生成路线
+	setPhotos([]string{"a.jpg", "b.jpg"}, []string{"2024-05-01 10:00:00", ""})
+	td.makeRoute(t.TempDir(), &config.UserConfig{DrawRoute: true})
+	if pData.routeFile != "" {
+		t.Errorf("无法连成路线时不应记录路线文件")
+	}
+}
+
+func TestExportGeoJSON(t *testing.T) {
+	setPhotos([]string{"a.jpg", "b.jpg"}, []string{"2024-05-01 10:00:00", ""})
+	pData.device = []string{"iPhone", ""}
+	pData.convertedLocation[1] = location{39.912, 116.306}
+	td := &TravelData{TravelName: "trip", Inputs: []*model.InputSourceData{{Path: "/in"}}, Exports: []string{Export_GeoJSON, "未知格式"}}
+
+	dir := t.TempDir()
+	if failed := td.makeExports(dir, &config.UserConfig{}); len(failed) != 0 {
+		t.Fatal(failed)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "trip.geojson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fc struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry struct {
+				Type        string     `json:"type"`
+				Coordinates [2]float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(data, &fc); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Type != "FeatureCollection" || len(fc.Features) != 2 {
+		t.Fatalf("应导出2个点要素：%s", data)
+	}
+	for i, f := range fc.Features {
+		raw := pData.rawLocation[i]
+		//几何坐标使用WGS-84，顺序为[经度,纬度]
+		if f.Geometry.Type != "Point" || f.Geometry.Coordinates != [2]float64{raw.long, raw.lat} {
+			t.Errorf("第%d个点坐标为%v", i+1, f.Geometry.Coordinates)
+		}
+		if f.Properties["name"] != pData.validPhotos[i] || f.Properties["gcj02_lat"] != pData.convertedLocation[i].lat {
+			t.Errorf("第%d个点属性错误：%v", i+1, f.Properties)
+		}
+	}
+	if fc.Features[0].Properties["device"] != "iPhone" || fc.Features[1].Properties["time"] != "" {
+		t.Errorf("拍摄设备或拍摄时间错误")
+	}
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"encoding/xml"
+	"io"
+	"math"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// gpxDocument GPX 1.1文档
+type gpxDocument struct {
+	XMLName   xml.Name      `xml:"gpx"`
+	Xmlns     string        `xml:"xmlns,attr"`
+	Version   string        `xml:"version,attr"`
+	Creator   string        `xml:"creator,attr"`
+	Name      string        `xml:"metadata>name"`
+	Waypoints []gpxWaypoint `xml:"wpt"`
+	Track     *gpxTrack     `xml:"trk,omitempty"`
+}
+
+// gpxWaypoint 航点，也用作轨迹点
+type gpxWaypoint struct {
+	Lat  float64  `xml:"lat,attr"`
+	Lon  float64  `xml:"lon,attr"`
+	Ele  *float64 `xml:"ele,omitempty"`
+	Time string   `xml:"time,omitempty"`
+	Name string   `xml:"name,omitempty"`
+	Desc string   `xml:"desc,omitempty"`
+	Link *gpxLink `xml:"link,omitempty"`
+}
+
+// gpxLink 航点指向照片的链接
+type gpxLink struct {
+	Href string `xml:"href,attr"`
+	Text string `xml:"text,omitempty"`
+}
+
+// gpxTrack 轨迹
+type gpxTrack struct {
+	Name   string        `xml:"name"`
+	Points []gpxWaypoint `xml:"trkseg>trkpt"`
+}
+
+// gpxPoint 生成导出照片对应的GPX点，使用原始WGS-84坐标
+func gpxPoint(p exportPoint) gpxWaypoint {
+	wpt := gpxWaypoint{
+		Lat: p.raw.lat,
+		Lon: p.raw.long,
+	}
+	if alt := p.altitude; !math.IsNaN(alt) {
+		wpt.Ele = &alt
+	}
+	if t, ok := parsePhotoTime(p.date); ok {
+		wpt.Time = t.UTC().Format(time.RFC3339)
+	}
+	return wpt
+}
+
+// photoLink 获取第i张有效照片的文件链接。转存照片时指向转存后的照片，否则指向原照片
+func (t *TravelData) photoLink(i int, basePath string, cfg *config.UserConfig) string {
+	path := t.photoSource(i)
+	if cfg.MovePhoto {
+		path = filepath.Join(copyDir(basePath, cfg), photoName(i))
+	}
+	return fileLink(path)
+}
+
+// fileLink 将文件路径转换为file://链接
+func fileLink(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") { //Windows路径，如C:/photos
+		path = "/" + path
+	}
+	u := url.URL{Scheme: "file", Path: path}
+	return u.String()
+}
+
+// exportGPX 导出GPX文件，每张照片一个航点，并按拍摄时间先后生成轨迹
+func (t *TravelData) exportGPX(basePath string, points []exportPoint) error {
+	doc := gpxDocument{
+		Xmlns:   "http://www.topografix.com/GPX/1/1",
+		Version: "1.1",
+		Creator: "MapPhotoMD",
+		Name:    t.TravelName,
+	}
+
+	//航点
+	for _, p := range points {
+		wpt := gpxPoint(p)
+		wpt.Name = p.name
+		wpt.Desc = p.device
+		if p.link != "" {
+			wpt.Link = &gpxLink{Href: p.link, Text: p.name}
+		}
+		doc.Waypoints = append(doc.Waypoints, wpt)
+	}
+
+	//轨迹
+	order := exportOrder(points)
+	if len(order) >= 2 {
+		doc.Track = &gpxTrack{Name: t.TravelName}
+		for _, i := range order {
+			doc.Track.Points = append(doc.Track.Points, gpxPoint(points[i]))
+		}
+	}
+
+	file, err := createFile(filepath.Join(basePath, t.TravelName+".gpx"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := io.WriteString(file, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(file)
+	enc.Indent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"MapPhotoMD/internal/model"
+	"encoding/xml"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportGPX(t *testing.T) {
+	setPhotos([]string{"b.jpg", "a.jpg", "nodate.jpg"}, []string{"2024-05-01 11:00:00", "2024-05-01 10:00:00", ""})
+	pData.altitude = []float64{12.5, math.NaN(), -3}
+	pData.device = []string{"iPhone", "", ""}
+	in := t.TempDir()
+	td := &TravelData{TravelName: "trip", Inputs: []*model.InputSourceData{{Path: in}}}
+
+	dir := t.TempDir()
+	if err := td.exportGPX(dir, td.exportPoints(dir, &config.UserConfig{})); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "trip.gpx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), xml.Header) {
+		t.Errorf("缺少XML声明")
+	}
+	var doc gpxDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != "1.1" || doc.Name != "trip" || len(doc.Waypoints) != 3 {
+		t.Fatalf("GPX文档错误：%s", data)
+	}
+
+	//航点使用WGS-84坐标，没有海拔或拍摄时间时省略
+	wpt := doc.Waypoints[0]
+	if wpt.Lat != pData.rawLocation[0].lat || wpt.Lon != pData.rawLocation[0].long || wpt.Name != "b.jpg" || wpt.Desc != "iPhone" {
+		t.Errorf("航点错误：%+v", wpt)
+	}
+	if wpt.Ele == nil || *wpt.Ele != 12.5 || doc.Waypoints[1].Ele != nil || *doc.Waypoints[2].Ele != -3 {
+		t.Errorf("海拔错误")
+	}
+	taken, _ := time.ParseInLocation("2006-01-02 15:04:05", "2024-05-01 11:00:00", time.Local)
+	if wpt.Time != taken.UTC().Format(time.RFC3339) || doc.Waypoints[2].Time != "" {
+		t.Errorf("时间应转换为UTC：%s", wpt.Time)
+	}
+	wantLink := "file://" + filepath.ToSlash(filepath.Join(in, "b.jpg"))
+	if wpt.Link == nil || wpt.Link.Href != wantLink {
+		t.Errorf("照片链接为%+v，应为%s", wpt.Link, wantLink)
+	}
+
+	//轨迹按拍摄时间排列，没有拍摄时间的照片不在轨迹中
+	if doc.Track == nil || len(doc.Track.Points) != 2 || doc.Track.Points[0].Lat != pData.rawLocation[1].lat {
+		t.Errorf("轨迹错误：%+v", doc.Track)
+	}
+}
+
+func TestExportGPXWithoutTrack(t *testing.T) {
+	setPhotos([]string{"a.jpg"}, []string{"2024-05-01 10:00:00"})
+	td := &TravelData{TravelName: "trip", Inputs: []*model.InputSourceData{{Path: t.TempDir()}}}
+	dir := t.TempDir()
+	if err := td.exportGPX(dir, td.exportPoints(dir, &config.UserConfig{})); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "trip.gpx"))
+	if strings.Contains(string(data), "<trk>") {
+		t.Errorf("只有一个点时不应生成轨迹：%s", data)
+	}
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"os"
+
+	"golang.org/x/image/draw"
+)
+
+// resizeImage 将图片等比缩小到长边不超过maxEdge像素，使用Catmull-Rom插值。图片本身足够小或maxEdge不大于0时原样返回
+func resizeImage(img image.Image, maxEdge int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if maxEdge <= 0 || (w <= maxEdge && h <= maxEdge) {
+		return img
+	}
+	if w >= h {
+		h = h * maxEdge / w
+		w = maxEdge
+	} else {
+		w = w * maxEdge / h
+		h = maxEdge
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, max(w, 1), max(h, 1)))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// downscaledJPEG 读取照片，缩小到长边不超过maxEdge像素并按EXIF方向值摆正后，按指定质量编码为JPEG
+func downscaledJPEG(path string, maxEdge int, quality int, orientation int) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	//先缩小再旋转，减少需要处理的像素
+	img = applyOrientation(resizeImage(img, maxEdge), orientation)
+	err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// applyOrientation 按EXIF方向值旋转、翻转图片，使其以正确的方向显示。方向值为1或无效时原样返回
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	w, h := b.Dx(), b.Dy()
+
+	//方向值5~8时宽高互换
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			//计算目标像素对应的原图像素
+			var sx, sy int
+			switch orientation {
+			case 2: //水平翻转
+				sx, sy = w-1-x, y
+			case 3: //旋转180度
+				sx, sy = w-1-x, h-1-y
+			case 4: //垂直翻转
+				sx, sy = x, h-1-y
+			case 5: //沿主对角线翻转
+				sx, sy = y, x
+			case 6: //顺时针旋转90度
+				sx, sy = y, h-1-x
+			case 7: //沿副对角线翻转
+				sx, sy = w-1-y, h-1-x
+			case 8: //逆时针旋转90度
+				sx, sy = w-1-y, x
+			}
+			si := src.PixOffset(sx, sy)
+			di := dst.PixOffset(x, y)
+			copy(dst.Pix[di:di+4], src.Pix[si:si+4])
+		}
+	}
+	return dst
+}
+
+// 估算输出大小时假定的原照片尺寸（1200万像素，4:3）
+const (
+	assumedPhotoWidth  = 4000
+	assumedPhotoHeight = 3000
+)
+
+// 不同JPEG质量下每像素大约占用的字节数，由常见照片实测得出
+var jpegBytesPerPixel = []struct {
+	quality int
+	bpp     float64
+}{
+	{0, 0.03}, {20, 0.08}, {50, 0.15}, {75, 0.25}, {90, 0.45}, {100, 1.0},
+}
+
+// EstimatePhotoSize 估算一张1200万像素照片按指定质量和最大长边转存后的大小，单位字节。
+// 质量为100且不限制长边时照片原样复制，返回0表示与原照片相同
+func EstimatePhotoSize(quality int, maxEdge int) int64 {
+	if quality >= 100 && (maxEdge <= 0 || maxEdge >= assumedPhotoWidth) {
+		return 0
+	}
+	return estimateJPEGSize(assumedPhotoWidth, assumedPhotoHeight, quality, maxEdge)
+}
+
+// estimateJPEGSize 估算宽高为w、h的图片缩小到最大长边以内后，按指定质量编码为JPEG的大小，单位字节
+func estimateJPEGSize(w int, h int, quality int, maxEdge int) int64 {
+	if maxEdge > 0 && (w > maxEdge || h > maxEdge) {
+		if w >= h {
+			w, h = maxEdge, h*maxEdge/w
+		} else {
+			w, h = w*maxEdge/h, maxEdge
+		}
+	}
+
+	//在相邻的两个质量之间线性插值
+	bpp := jpegBytesPerPixel[len(jpegBytesPerPixel)-1].bpp
+	for i := 1; i < len(jpegBytesPerPixel); i++ {
+		lo, hi := jpegBytesPerPixel[i-1], jpegBytesPerPixel[i]
+		if quality <= hi.quality {
+			bpp = lo.bpp + (hi.bpp-lo.bpp)*float64(quality-lo.quality)/float64(hi.quality-lo.quality)
+			break
+		}
+	}
+	return int64(float64(w*h) * bpp)
+}
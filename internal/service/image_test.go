@@ -0,0 +1,161 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"MapPhotoMD/internal/model"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyOrientation(t *testing.T) {
+	//2x3的图片，左上角为红色
+	img := image.NewRGBA(image.Rect(0, 0, 2, 3))
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	tests := []struct {
+		orientation int
+		w, h        int
+		redX, redY  int //摆正后红色像素的位置
+	}{
+		{1, 2, 3, 0, 0},
+		{2, 2, 3, 1, 0},
+		{3, 2, 3, 1, 2},
+		{4, 2, 3, 0, 2},
+		{5, 3, 2, 0, 0},
+		{6, 3, 2, 2, 0},
+		{7, 3, 2, 2, 1},
+		{8, 3, 2, 0, 1},
+		{9, 2, 3, 0, 0},
+	}
+	for _, tt := range tests {
+		got := applyOrientation(img, tt.orientation)
+		b := got.Bounds()
+		if b.Dx() != tt.w || b.Dy() != tt.h {
+			t.Errorf("方向值%d：尺寸为%dx%d，应为%dx%d", tt.orientation, b.Dx(), b.Dy(), tt.w, tt.h)
+			continue
+		}
+		if r, _, _, _ := got.At(tt.redX, tt.redY).RGBA(); r>>8 != 255 {
+			t.Errorf("方向值%d：红色像素不在(%d,%d)", tt.orientation, tt.redX, tt.redY)
+		}
+	}
+}
+
+func TestMakeThumbnails(t *testing.T) {
+	in := t.TempDir()
+	writeTestJPEG(t, in, "a.jpg")
+	setPhotos([]string{"a.jpg", "missing.jpg"}, []string{"", ""})
+	pData.orientation[0] = 6
+	assignMarkerNames("{name}", nil)
+	td := &TravelData{Inputs: []*model.InputSourceData{{Path: in}}}
+
+	out := t.TempDir()
+	td.makeThumbnails(out, &config.UserConfig{MakeThumbnail: false})
+	if len(pData.thumbnails) != 2 || pData.thumbnails[0] != "" {
+		t.Errorf("未开启时不应生成缩略图")
+	}
+
+	td.makeThumbnails(out, &config.UserConfig{MakeThumbnail: true, ThumbnailSize: 4})
+	//无法读取的照片没有缩略图
+	if pData.thumbnails[0] != "a_thumb.jpg" || pData.thumbnails[1] != "" {
+		t.Fatalf("缩略图为%v", pData.thumbnails)
+	}
+	file, err := os.Open(filepath.Join(out, "thumbnails", "a_thumb.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	cfg, err := jpeg.DecodeConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//8x4的原图缩小到长边4像素，再按方向值6旋转
+	if cfg.Width != 2 || cfg.Height != 4 {
+		t.Errorf("缩略图尺寸为%dx%d，应为2x4", cfg.Width, cfg.Height)
+	}
+}
+
+func TestResizeImage(t *testing.T) {
+	tests := []struct {
+		name    string
+		w, h    int
+		maxEdge int
+		wantW   int
+		wantH   int
+	}{
+		{"横图", 400, 300, 200, 200, 150},
+		{"竖图", 300, 400, 200, 150, 200},
+		{"足够小", 100, 50, 200, 100, 50},
+		{"不限制", 400, 300, 0, 400, 300},
+		{"极窄的图片至少保留1像素", 1000, 1, 10, 10, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewGray(image.Rect(0, 0, tt.w, tt.h))
+			b := resizeImage(img, tt.maxEdge).Bounds()
+			if b.Dx() != tt.wantW || b.Dy() != tt.wantH {
+				t.Errorf("尺寸为%dx%d，应为%dx%d", b.Dx(), b.Dy(), tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestEstimatePhotoSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		quality int
+		maxEdge int
+		want    int64
+	}{
+		{"原样复制", 100, 0, 0},
+		{"长边不小于原照片时原样复制", 100, 4000, 0},
+		{"只缩小", 100, 2000, 2000 * 1500},
+		{"表中的质量", 75, 0, 4000 * 3000 / 4},
+		{"插值", 80, 0, int64(4000 * 3000 * (0.25 + 0.2/3))},
+		{"压缩并缩小", 50, 1000, int64(1000 * 750 * 0.15)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimatePhotoSize(tt.quality, tt.maxEdge); got != tt.want {
+				t.Errorf("得到%d，应为%d", got, tt.want)
+			}
+		})
+	}
+	//质量越高、长边越大，估算大小越大
+	if EstimatePhotoSize(60, 0) >= EstimatePhotoSize(70, 0) || EstimatePhotoSize(60, 1000) >= EstimatePhotoSize(60, 2000) {
+		t.Errorf("估算大小应随质量和长边增大")
+	}
+}
+
+func TestNeedReencode(t *testing.T) {
+	dir := t.TempDir()
+	writeTestJPEG(t, dir, "a.jpg")
+	file, err := os.Open(filepath.Join(dir, "a.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	tests := []struct {
+		name    string
+		quality int
+		maxEdge int
+		want    bool
+	}{
+		{"原样复制", 100, 0, false},
+		{"压缩", 90, 0, true},
+		{"超过最大长边", 100, 4, true},
+		{"未超过最大长边", 100, 8, false},
+	}
+	for _, tt := range tests {
+		got := needReencode(file, &config.UserConfig{PhotoQuality: tt.quality, PhotoMaxEdge: tt.maxEdge})
+		if got != tt.want {
+			t.Errorf("%s：得到%v，应为%v", tt.name, got, tt.want)
+		}
+		//判断后应回到文件开头，以便之后复制或解码
+		if pos, _ := file.Seek(0, 1); pos != 0 {
+			t.Errorf("%s：文件位置为%d", tt.name, pos)
+		}
+	}
+}
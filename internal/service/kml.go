@@ -0,0 +1,182 @@
+package service
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// KMZ中照片的最大长边像素及JPEG质量
+const (
+	kmzPhotoEdge    = 800
+	kmzPhotoQuality = 85
+)
+
+// kmlDocument KML文档
+type kmlDocument struct {
+	XMLName xml.Name  `xml:"kml"`
+	Xmlns   string    `xml:"xmlns,attr"`
+	Name    string    `xml:"Document>name"`
+	Style   kmlStyle  `xml:"Document>Style"`
+	Folder  kmlFolder `xml:"Document>Folder"`
+	Path    *kmlPath  `xml:"Document>Placemark,omitempty"`
+}
+
+// kmlStyle 路线样式
+type kmlStyle struct {
+	ID    string `xml:"id,attr"`
+	Color string `xml:"LineStyle>color"`
+	Width int    `xml:"LineStyle>width"`
+}
+
+// kmlFolder 存放照片地标的文件夹
+type kmlFolder struct {
+	Name       string         `xml:"name"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+// kmlPlacemark 照片地标
+type kmlPlacemark struct {
+	Name        string        `xml:"name"`
+	TimeStamp   *kmlTimeStamp `xml:"TimeStamp,omitempty"`
+	Description kmlCDATA      `xml:"description"`
+	Coordinates string        `xml:"Point>coordinates"`
+}
+
+// kmlTimeStamp 地标的时间戳
+type kmlTimeStamp struct {
+	When string `xml:"when"`
+}
+
+// kmlCDATA 以CDATA形式写入的文本，用于地标气泡中的HTML
+type kmlCDATA struct {
+	Text string `xml:",cdata"`
+}
+
+// kmlPath 按时间顺序连接照片的路线地标
+type kmlPath struct {
+	Name        string `xml:"name"`
+	StyleURL    string `xml:"styleUrl"`
+	Tessellate  int    `xml:"LineString>tessellate"`
+	Coordinates string `xml:"LineString>coordinates"`
+}
+
+// buildKML 生成KML文档，坐标使用WGS-84。photoHref非空且返回值不为空时，地标的气泡中显示第i张照片
+func (t *TravelData) buildKML(points []exportPoint, photoHref func(i int) string) kmlDocument {
+	doc := kmlDocument{
+		Xmlns: "http://www.opengis.net/kml/2.2",
+		Name:  t.TravelName,
+		Style: kmlStyle{ID: "route", Color: "ffff8833", Width: 3},
+	}
+
+	//照片地标
+	doc.Folder.Name = "照片"
+	for i, p := range points {
+		pm := kmlPlacemark{
+			Name:        p.name,
+			Coordinates: fmt.Sprintf("%f,%f,0", p.raw.long, p.raw.lat),
+		}
+		if pt, ok := parsePhotoTime(p.date); ok {
+			pm.TimeStamp = &kmlTimeStamp{When: pt.Format("2006-01-02T15:04:05-07:00")}
+		}
+		desc := fmt.Sprintf("拍摄时间：%s<br/>拍摄设备：%s", html.EscapeString(p.date), html.EscapeString(p.device))
+		if photoHref != nil && photoHref(i) != "" {
+			desc = fmt.Sprintf(`<img src="%s" width="400"/><br/>`, html.EscapeString(photoHref(i))) + desc
+		}
+		pm.Description = kmlCDATA{desc}
+		doc.Folder.Placemarks = append(doc.Folder.Placemarks, pm)
+	}
+
+	//按时间顺序连成路线
+	order := exportOrder(points)
+	if len(order) >= 2 {
+		coords := make([]string, 0, len(order))
+		for _, i := range order {
+			coords = append(coords, fmt.Sprintf("%f,%f,0", points[i].raw.long, points[i].raw.lat))
+		}
+		doc.Path = &kmlPath{
+			Name:        "路线",
+			StyleURL:    "#route",
+			Tessellate:  1,
+			Coordinates: strings.Join(coords, " "),
+		}
+	}
+	return doc
+}
+
+// writeKML 将KML文档写入w
+func writeKML(w io.Writer, doc kmlDocument) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(doc)
+}
+
+// exportKML 导出KML文件，包含带时间戳的照片地标和按时间顺序连接的路线
+func (t *TravelData) exportKML(basePath string, points []exportPoint) error {
+	file, err := createFile(filepath.Join(basePath, t.TravelName+".kml"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return writeKML(file, t.buildKML(points, nil))
+}
+
+// exportKMZ 导出KMZ文件，在KML的基础上打包缩小后的照片，地标气泡中显示照片
+func (t *TravelData) exportKMZ(basePath string, points []exportPoint) error {
+	file, err := createFile(filepath.Join(basePath, t.TravelName+".kmz"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+	//KMZ规定第一个文件为主KML文件
+	w, err := zw.Create("doc.kml")
+	if err != nil {
+		return err
+	}
+	//已有标记点找不到照片时不打包，气泡中不显示照片
+	href := func(i int) string {
+		if points[i].path == "" {
+			return ""
+		}
+		return "files/" + points[i].marker + ".jpg"
+	}
+	if err := writeKML(w, t.buildKML(points, href)); err != nil {
+		return err
+	}
+
+	//打包缩小后的照片，无法读取的照片跳过，打包完成后返回错误
+	var missing []string
+	for i, p := range points {
+		if p.path == "" {
+			continue
+		}
+		data, err := downscaledJPEG(p.path, kmzPhotoEdge, kmzPhotoQuality, p.orientation)
+		if err != nil {
+			missing = append(missing, p.name)
+			continue
+		}
+		w, err := zw.Create(href(i))
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if len(missing) != 0 {
+		return fmt.Errorf("以下照片无法读取，未打包：%s", strings.Join(missing, "、"))
+	}
+	return nil
+}
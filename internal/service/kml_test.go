@@ -0,0 +1,98 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"MapPhotoMD/internal/model"
+	"archive/zip"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestJPEG 在dir下写入一张没有EXIF的小图
+func writeTestJPEG(t *testing.T, dir string, name string) {
+	t.Helper()
+	file, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := jpeg.Encode(file, image.NewGray(image.Rect(0, 0, 8, 4)), nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuildKML(t *testing.T) {
+	setPhotos([]string{"a.jpg", "b.jpg", "nodate.jpg"}, []string{"2024-05-01 11:00:00", "2024-05-01 10:00:00", ""})
+	td := &TravelData{TravelName: "trip", Inputs: []*model.InputSourceData{{Path: "/in"}}}
+
+	doc := td.buildKML(td.exportPoints("", &config.UserConfig{}), nil)
+	if doc.Name != "trip" || len(doc.Folder.Placemarks) != 3 {
+		t.Fatalf("应有3个照片地标：%+v", doc.Folder.Placemarks)
+	}
+	//坐标使用WGS-84，顺序为经度,纬度,海拔
+	if got := doc.Folder.Placemarks[0].Coordinates; got != "116.300000,39.900000,0" {
+		t.Errorf("地标坐标为%s", got)
+	}
+	if doc.Folder.Placemarks[0].TimeStamp == nil || doc.Folder.Placemarks[2].TimeStamp != nil {
+		t.Errorf("只有有拍摄时间的照片才有时间戳")
+	}
+	if strings.Contains(doc.Folder.Placemarks[0].Description.Text, "<img") {
+		t.Errorf("KML中不应引用照片")
+	}
+	//路线按拍摄时间连接，没有拍摄时间的照片不在路线上
+	if doc.Path == nil || doc.Path.Coordinates != "116.300000,39.910000,0 116.300000,39.900000,0" {
+		t.Errorf("路线为%+v", doc.Path)
+	}
+
+	withPhoto := td.buildKML(td.exportPoints("", &config.UserConfig{}), func(i int) string { return "files/" + pData.validPhotos[i] })
+	if !strings.Contains(withPhoto.Folder.Placemarks[1].Description.Text, `<img src="files/b.jpg"`) {
+		t.Errorf("KMZ的地标气泡中应显示照片：%s", withPhoto.Folder.Placemarks[1].Description.Text)
+	}
+}
+
+func TestExportKMZ(t *testing.T) {
+	in := t.TempDir()
+	out := t.TempDir()
+	writeTestJPEG(t, in, "a.jpg")
+	writeTestJPEG(t, in, "b.jpg")
+	td := &TravelData{TravelName: "trip", Inputs: []*model.InputSourceData{{Path: in}}}
+
+	tests := []struct {
+		name      string
+		photos    []string
+		wantFiles []string
+		wantErr   string
+	}{
+		{"打包所有照片", []string{"a.jpg", "b.jpg"}, []string{"doc.kml", "files/a.jpg", "files/b.jpg"}, ""},
+		{"原照片已不存在时报告错误", []string{"a.jpg", "missing.jpg"}, []string{"doc.kml", "files/a.jpg"}, "missing.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setPhotos(tt.photos, []string{"2024-05-01 10:00:00", "2024-05-01 11:00:00"})
+			assignMarkerNames("{name}", nil)
+			err := td.exportKMZ(out, td.exportPoints(out, &config.UserConfig{}))
+			if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("错误为%v，应包含%s", err, tt.wantErr)
+			}
+			zr, err := zip.OpenReader(filepath.Join(out, "trip.kmz"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer zr.Close()
+			var files []string
+			for _, f := range zr.File {
+				files = append(files, f.Name)
+			}
+			if strings.Join(files, ",") != strings.Join(tt.wantFiles, ",") {
+				t.Errorf("KMZ中的文件为%v，应为%v", files, tt.wantFiles)
+			}
+		})
+	}
+}
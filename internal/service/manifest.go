@@ -0,0 +1,311 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// 旅行记录文件夹中保存生成清单和备份的目录，Obsidian不会显示以.开头的目录
+const manifestDir = ".mapphotomd"
+
+// 生成记录文件，与配置文件放在同一目录下，按先后顺序记录每次生成的清单路径，用于撤销上次生成
+const historyFile = "generation_history.json"
+
+// 清单中文件的操作类型
+const (
+	fileCreated     = "created"     //新建的文件
+	fileOverwritten = "overwritten" //覆盖的已有文件，覆盖前已备份
+)
+
+// ManifestFile 生成时写入的一个文件
+type ManifestFile struct {
+	Path   string `json:"path"`             //文件路径
+	Action string `json:"action"`           //操作类型，新建或覆盖
+	SHA256 string `json:"sha256"`           //写入后文件内容的SHA-256
+	Backup string `json:"backup,omitempty"` //覆盖前的备份路径，只在覆盖已有文件时有值
+}
+
+// Manifest 一次生成的清单，记录写入的文件、删除的原照片和使用的设置，用于审计和撤销
+type Manifest struct {
+	ID            string             `json:"id"`                       //生成编号，即生成时间，用于命名清单和备份目录
+	Time          string             `json:"time"`                     //生成时间
+	TravelName    string             `json:"travel_name"`              //旅行名称
+	BasePath      string             `json:"base_path"`                //旅行记录文件夹
+	Update        bool               `json:"update"`                   //是否以更新模式生成
+	Files         []ManifestFile     `json:"files"`                    //写入的文件
+	DeletedBatch  string             `json:"deleted_batch,omitempty"`  //删除原照片的批次，对应删除记录
+	DeletedPhotos []string           `json:"deleted_photos,omitempty"` //删除（移走）的原照片
+	Settings      *config.UserConfig `json:"settings"`                 //使用的设置，不含高德Key、隐私区域和本机路径
+	Geofences     int                `json:"geofences"`                //使用的隐私区域数量
+}
+
+// manifestRecorder 记录本次生成写入的文件，覆盖已有文件前先备份
+type manifestRecorder struct {
+	backupDir string          //本次生成的备份目录
+	files     []ManifestFile  //写入的文件
+	seen      map[string]bool //已记录的文件，同一文件只在第一次写入前备份
+}
+
+// newManifestRecorder 创建记录器，备份保存在旅行记录文件夹的.mapphotomd/backup/<生成编号>下
+func newManifestRecorder(basePath string, id string) *manifestRecorder {
+	if abs, err := filepath.Abs(basePath); err == nil {
+		basePath = abs //生成记录可能在其他目录下使用，备份路径使用绝对路径
+	}
+	return &manifestRecorder{
+		backupDir: filepath.Join(basePath, manifestDir, "backup", id),
+		seen:      make(map[string]bool),
+	}
+}
+
+// manifestID 按生成时间生成编号，同一秒内多次生成时追加_2、_3……，避免覆盖之前的清单
+func manifestID(basePath string, now time.Time) string {
+	id := now.Format("20060102_150405")
+	for i := 2; ; i++ {
+		if _, err := os.Stat(filepath.Join(basePath, manifestDir, "manifest_"+id+".json")); err != nil {
+			return id
+		}
+		id = fmt.Sprintf("%s_%d", now.Format("20060102_150405"), i)
+	}
+}
+
+// recordWrite 在写入文件前调用，记录该文件。文件已存在时先备份，以便撤销时还原。
+// 没有正在进行的生成时不做任何事
+func recordWrite(path string) {
+	r := pData.recorder
+	if r == nil {
+		return
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	if r.seen[abs] {
+		return
+	}
+	r.seen[abs] = true
+
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		r.files = append(r.files, ManifestFile{Path: abs, Action: fileCreated})
+		return
+	}
+	//备份文件按序号命名，避免不同目录下的同名文件冲突
+	backup := filepath.Join(r.backupDir, fmt.Sprintf("%04d_%s", len(r.files)+1, filepath.Base(abs)))
+	if err := os.MkdirAll(r.backupDir, 0755); err == nil {
+		if err := os.WriteFile(backup, data, 0644); err == nil {
+			r.files = append(r.files, ManifestFile{Path: abs, Action: fileOverwritten, Backup: backup})
+			return
+		}
+	}
+	//备份失败时仍记录为覆盖，撤销时无法还原该文件
+	r.files = append(r.files, ManifestFile{Path: abs, Action: fileOverwritten})
+}
+
+// createFile 记录并创建文件，用于生成旅行记录时写入的所有文件
+func createFile(path string) (*os.File, error) {
+	recordWrite(path)
+	return os.Create(path)
+}
+
+// writeFile 记录并写入文件，用于生成旅行记录时写入的所有文件
+func writeFile(path string, data []byte) error {
+	recordWrite(path)
+	return os.WriteFile(path, data, 0644)
+}
+
+// saveManifest 计算写入的各文件的哈希，将清单保存到旅行记录文件夹，并加入生成记录
+func (t *TravelData) saveManifest(r *manifestRecorder, id string, generated string, basePath string, deleted []deletedPhoto, cfg *config.UserConfig) error {
+	m := Manifest{
+		ID:         id,
+		Time:       generated,
+		TravelName: t.TravelName,
+		BasePath:   basePath,
+		Update:     pData.update,
+		Settings:   manifestSettings(cfg),
+		Geofences:  len(cfg.Geofences),
+	}
+	if abs, err := filepath.Abs(basePath); err == nil {
+		m.BasePath = abs
+	}
+	for _, f := range r.files {
+		hash, err := fileHash(f.Path)
+		if err != nil && f.Action == fileCreated { //写入失败、没有留下的文件不需要记录
+			continue
+		}
+		f.SHA256 = hash
+		m.Files = append(m.Files, f)
+	}
+	for _, d := range deleted {
+		m.DeletedBatch = d.Batch
+		m.DeletedPhotos = append(m.DeletedPhotos, d.Original)
+	}
+
+	path, err := writeManifest(&m)
+	if err != nil {
+		return err
+	}
+
+	history := loadHistory()
+	history = append(history, path)
+	return saveHistory(history)
+}
+
+// manifestSettings 获取写入清单的设置。清单保存在Ob库中，可能随旅行记录同步或分享，
+// 因此不保存高德Key、隐私区域（即用户想隐藏的位置）以及导入导出路径等本机路径
+func manifestSettings(cfg *config.UserConfig) *config.UserConfig {
+	settings := *cfg
+	settings.Key = ""
+	settings.Geofences = nil
+	settings.NotePath = ""
+	settings.IOPath = config.IOPath{Exports: cfg.IOPath.Exports}
+	settings.PhotoPath = ""
+	settings.DeletedPath = ""
+	settings.GeoDataPath = ""
+	return &settings
+}
+
+// writeManifest 将清单保存到旅行记录文件夹的.mapphotomd目录下，返回清单路径
+func writeManifest(m *Manifest) (string, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(m.BasePath, manifestDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "manifest_"+m.ID+".json")
+	return path, os.WriteFile(path, data, 0644)
+}
+
+// loadHistory 读取生成记录，文件不存在或损坏时返回空记录
+func loadHistory() []string {
+	var history []string
+	data, err := os.ReadFile(statePath(historyFile))
+	if err != nil {
+		return nil
+	}
+	json.Unmarshal(data, &history)
+	return history
+}
+
+// saveHistory 保存生成记录
+func saveHistory(history []string) error {
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(statePath(historyFile), data, 0644)
+}
+
+// LastGeneration 获取上次生成的清单，没有可撤销的生成时返回错误
+func LastGeneration() (*Manifest, error) {
+	history := loadHistory()
+	if len(history) == 0 {
+		return nil, errors.New("没有可以撤销的生成")
+	}
+	data, err := os.ReadFile(history[len(history)-1])
+	if err != nil {
+		return nil, fmt.Errorf("读取生成清单失败：%v", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("解析生成清单失败：%v", err)
+	}
+	return &m, nil
+}
+
+// UndoLastGeneration 撤销上次生成：删除新建的文件，用备份还原覆盖的文件，并将删除的原照片移回原位置。
+// 生成后被修改过的文件不会被删除或还原，以免丢失修改。有文件未能撤销时保留清单、备份和生成记录，
+// 清单中只留下未撤销的文件，处理后可以再次撤销，也可以从备份手动还原。返回处理的文件数量和未能撤销的文件及原因
+func UndoLastGeneration() (int, []string, error) {
+	m, err := LastGeneration()
+	if err != nil {
+		return 0, nil, err
+	}
+	undone := 0
+	var failed []string
+	var remain []ManifestFile //未能撤销的文件，按原顺序保存
+	dirs := make(map[string]bool)
+
+	//倒序撤销，后写入的文件先处理
+	for i := len(m.Files) - 1; i >= 0; i-- {
+		f := m.Files[i]
+		if hash, err := fileHash(f.Path); err != nil || hash != f.SHA256 {
+			if f.Action == fileCreated && errors.Is(err, os.ErrNotExist) {
+				continue //文件已被删除，无需处理
+			}
+			msg := f.Path + "：生成后已被修改，未撤销"
+			if f.Backup != "" {
+				msg += "，生成前的内容备份在" + f.Backup
+			}
+			failed = append(failed, msg)
+			remain = append([]ManifestFile{f}, remain...)
+			continue
+		}
+		switch {
+		case f.Action == fileCreated:
+			err = os.Remove(f.Path)
+			dirs[filepath.Dir(f.Path)] = true
+		case f.Backup != "":
+			var data []byte
+			if data, err = os.ReadFile(f.Backup); err == nil {
+				err = os.WriteFile(f.Path, data, 0644)
+			}
+		default:
+			err = errors.New("没有备份，无法还原")
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s：%v", f.Path, err))
+			remain = append([]ManifestFile{f}, remain...)
+			continue
+		}
+		undone++
+	}
+
+	//恢复删除的原照片
+	if m.DeletedBatch != "" {
+		restored, restoreFailed := restoreBatch(m.DeletedBatch)
+		undone += restored
+		failed = append(failed, restoreFailed...)
+	}
+
+	//未完全撤销时保留备份和生成记录，只更新清单
+	if len(failed) != 0 {
+		m.Files = remain
+		if _, err := writeManifest(m); err != nil {
+			failed = append(failed, fmt.Sprintf("生成清单：%v", err))
+		}
+		return undone, failed, nil
+	}
+
+	//删除本次生成的清单和备份，再由深到浅删除因此变空的目录，目录不为空时删除失败，保留目录
+	os.RemoveAll(filepath.Join(m.BasePath, manifestDir, "backup", m.ID))
+	os.Remove(filepath.Join(m.BasePath, manifestDir, "manifest_"+m.ID+".json"))
+	dirs[filepath.Join(m.BasePath, manifestDir, "backup")] = true
+	dirs[filepath.Join(m.BasePath, manifestDir)] = true
+	dirs[m.BasePath] = true
+	var dirList []string
+	for dir := range dirs {
+		dirList = append(dirList, dir)
+	}
+	sort.Slice(dirList, func(a, b int) bool { return len(dirList[a]) > len(dirList[b]) })
+	for _, dir := range dirList {
+		os.Remove(dir)
+	}
+
+	history := loadHistory()
+	if len(history) > 0 {
+		history = history[:len(history)-1]
+	}
+	if err := saveHistory(history); err != nil {
+		failed = append(failed, fmt.Sprintf("%s：%v", historyFile, err))
+	}
+	return undone, failed, nil
+}
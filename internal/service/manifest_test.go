@@ -0,0 +1,165 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testGeneration 模拟一次生成：覆盖手写的旅行记录、新建标记点，并删除原照片
+type testGeneration struct {
+	base     string //旅行记录文件夹
+	note     string //旅行记录文件
+	marker   string //新建的标记点文件
+	original string //原照片
+	id       string //生成编号
+}
+
+// generate 在dir下执行一次模拟生成并保存清单
+func generate(t *testing.T, dir string, cfg *config.UserConfig) testGeneration {
+	t.Helper()
+	g := testGeneration{base: filepath.Join(dir, "out", "trip")}
+	g.note = filepath.Join(g.base, "trip.md")
+	g.marker = filepath.Join(g.base, "markers", "a.md")
+	g.original = filepath.Join(dir, "in", "a.jpg")
+	os.MkdirAll(filepath.Dir(g.marker), 0755)
+	os.MkdirAll(filepath.Dir(g.original), 0755)
+	os.WriteFile(g.note, []byte("手写的游记"), 0644)
+	os.WriteFile(g.original, []byte("原照片"), 0644)
+
+	pData = photoData{}
+	g.id = manifestID(g.base, time.Now())
+	r := newManifestRecorder(g.base, g.id)
+	pData.recorder = r
+	if err := writeFile(g.note, []byte("生成的游记")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(g.marker, []byte("标记点")); err != nil {
+		t.Fatal(err)
+	}
+	pData.recorder = nil
+	deleted, failed := recyclePhotos([]string{g.original}, cfg)
+	if len(failed) != 0 {
+		t.Fatal(failed)
+	}
+	td := &TravelData{TravelName: "trip"}
+	if err := td.saveManifest(r, g.id, "2024-05-01 10:00:00", g.base, deleted, cfg); err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestUndoLastGeneration(t *testing.T) {
+	dir := chdirTemp(t)
+	cfg := &config.UserConfig{DeleteTo: config.DeleteTo_Folder, DeletedPath: filepath.Join(dir, "holding")}
+	g := generate(t, dir, cfg)
+	if exists(g.original) || readText(g.note) != "生成的游记" {
+		t.Fatalf("模拟生成失败")
+	}
+
+	undone, failed, err := UndoLastGeneration()
+	if err != nil || len(failed) != 0 {
+		t.Fatalf("撤销失败：%v %v", err, failed)
+	}
+	if undone != 3 {
+		t.Errorf("撤销了%d个文件，应为3个", undone)
+	}
+	if got := readText(g.note); got != "手写的游记" {
+		t.Errorf("旅行记录为%q，应还原为手写的内容", got)
+	}
+	if exists(g.marker) || exists(filepath.Dir(g.marker)) {
+		t.Errorf("新建的标记点及其文件夹应被删除")
+	}
+	if readText(g.original) != "原照片" {
+		t.Errorf("原照片未恢复")
+	}
+	if exists(filepath.Join(g.base, manifestDir)) {
+		t.Errorf("完整撤销后应删除清单和备份")
+	}
+	if _, err := LastGeneration(); err == nil {
+		t.Errorf("完整撤销后应移除生成记录")
+	}
+}
+
+func TestUndoKeepsBackupWhenModified(t *testing.T) {
+	dir := chdirTemp(t)
+	cfg := &config.UserConfig{DeleteTo: config.DeleteTo_Folder, DeletedPath: filepath.Join(dir, "holding")}
+	g := generate(t, dir, cfg)
+	os.WriteFile(g.note, []byte("生成后又修改的游记"), 0644)
+
+	undone, failed, err := UndoLastGeneration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if undone != 2 || len(failed) != 1 || !strings.Contains(failed[0], g.note) {
+		t.Fatalf("撤销了%d个文件，未撤销%v，应只有修改过的旅行记录未撤销", undone, failed)
+	}
+	if got := readText(g.note); got != "生成后又修改的游记" {
+		t.Errorf("修改过的旅行记录不应被覆盖，现为%q", got)
+	}
+	//保留清单、备份和生成记录，清单中只留下未撤销的文件
+	m, err := LastGeneration()
+	if err != nil {
+		t.Fatalf("未完全撤销时应保留生成记录：%v", err)
+	}
+	if m.ID != g.id || len(m.Files) != 1 || m.Files[0].Path != g.note {
+		t.Fatalf("清单应只包含未撤销的旅行记录：%+v", m.Files)
+	}
+	if readText(m.Files[0].Backup) != "手写的游记" {
+		t.Fatalf("备份应保留生成前的内容")
+	}
+
+	//还原修改后再次撤销
+	os.WriteFile(g.note, []byte("生成的游记"), 0644)
+	undone, failed, err = UndoLastGeneration()
+	if err != nil || len(failed) != 0 || undone != 1 {
+		t.Fatalf("再次撤销：%d %v %v", undone, failed, err)
+	}
+	if got := readText(g.note); got != "手写的游记" {
+		t.Errorf("旅行记录为%q，应还原为手写的内容", got)
+	}
+	if exists(filepath.Join(g.base, manifestDir)) {
+		t.Errorf("完整撤销后应删除清单和备份")
+	}
+}
+
+func TestManifestID(t *testing.T) {
+	base := t.TempDir()
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.Local)
+	first := manifestID(base, now)
+	if first != "20240501_100000" {
+		t.Fatalf("生成编号为%s", first)
+	}
+	os.MkdirAll(filepath.Join(base, manifestDir), 0755)
+	os.WriteFile(filepath.Join(base, manifestDir, "manifest_"+first+".json"), nil, 0644)
+	if second := manifestID(base, now); second != "20240501_100000_2" {
+		t.Errorf("同一秒内的第二次生成编号为%s", second)
+	}
+}
+
+func TestManifestSettings(t *testing.T) {
+	cfg := config.NewUserConfig()
+	cfg.Key = "secret"
+	cfg.NotePath = "旅行"
+	cfg.Geofences = []config.Geofence{{Name: "家", Lat: 31.2, Long: 121.4, Radius: 500}}
+	cfg.IOPath.OutputPath = "/home/user/vault"
+	cfg.IOPath.Exports = []string{Export_GPX}
+	cfg.PhotoPath = "/home/user/vault/pictures"
+	cfg.DeletedPath = "/home/user/holding"
+	cfg.GeoDataPath = "/home/user/cities.txt"
+
+	s := manifestSettings(cfg)
+	if s.Key != "" || s.Geofences != nil || s.NotePath != "" || s.IOPath.OutputPath != "" ||
+		s.PhotoPath != "" || s.DeletedPath != "" || s.GeoDataPath != "" {
+		t.Errorf("清单中不应保存高德Key、隐私区域和本机路径：%+v", s)
+	}
+	if len(s.IOPath.Exports) != 1 || s.PhotoQuality != cfg.PhotoQuality {
+		t.Errorf("其他设置应保留：%+v", s)
+	}
+	if cfg.Key != "secret" || len(cfg.Geofences) != 1 {
+		t.Errorf("不应修改原设置")
+	}
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 默认的标记点命名模板
+const defaultMarkerName = "{name}"
+
+// 默认的转存照片命名模板
+const defaultPhotoName = "{date}_{time}_{trip}_{seq}"
+
+// photoTime 获取第i张有效照片的拍摄时间，照片没有拍摄时间时ok为false
+func photoTime(i int) (t time.Time, ok bool) {
+	return parsePhotoTime(pData.date[i])
+}
+
+// parsePhotoTime 解析拍摄时间，拍摄时间为空或格式错误时ok为false
+func parsePhotoTime(date string) (t time.Time, ok bool) {
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", date, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// photoHash 根据照片名称、原始经纬度和拍摄时间计算第i张有效照片的短哈希，同一张照片每次计算结果相同
+func photoHash(i int) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%f,%f|%s",
+		pData.validPhotos[i], pData.rawLocation[i].lat, pData.rawLocation[i].long, pData.date[i])))
+	return hex.EncodeToString(sum[:])[:8]
+}
+
+// expandNameTemplate 将命名模板中的占位符替换为第i张有效照片的信息。
+// 可用的占位符：{name} 照片名（不含扩展名）；{date} 拍摄日期；{time} 拍摄时间；{hash} 照片短哈希
+func expandNameTemplate(tpl string, i int) string {
+	return sanitizeFileName(templateReplacer(pData.validPhotos[i], pData.date[i], photoHash(i)).Replace(tpl))
+}
+
+// templateReplacer 创建替换命名模板占位符的替换器，extra为额外的占位符及其值
+func templateReplacer(fileName string, date string, hash string, extra ...string) *strings.Replacer {
+	fileName = filepath.Base(fileName)
+	day, clock := "nodate", "notime"
+	if t, ok := parsePhotoTime(date); ok {
+		day = t.Format("20060102")
+		clock = t.Format("150405")
+	}
+	return strings.NewReplacer(append([]string{
+		"{name}", strings.TrimSuffix(fileName, filepath.Ext(fileName)),
+		"{date}", day,
+		"{time}", clock,
+		"{hash}", hash,
+	}, extra...)...)
+}
+
+// sanitizeFileName 替换文件名中各系统不允许使用的字符
+func sanitizeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`\/:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+	return strings.TrimSpace(name)
+}
+
+// uniqueName 若name已被使用，则依次追加_2、_3……直到不再重复，并将结果记为已使用。比较时忽略大小写
+func uniqueName(name string, used map[string]bool) string {
+	unique := name
+	for n := 2; used[strings.ToLower(unique)]; n++ {
+		unique = fmt.Sprintf("%s_%d", name, n)
+	}
+	used[strings.ToLower(unique)] = true
+	return unique
+}
+
+// assignMarkerNames 按命名模板为每张有效照片生成不重复的标记点文件名，taken为已被占用的文件名
+func assignMarkerNames(tpl string, taken []string) {
+	if strings.TrimSpace(tpl) == "" {
+		tpl = defaultMarkerName
+	}
+	used := make(map[string]bool)
+	for _, name := range taken {
+		used[strings.ToLower(name)] = true
+	}
+	pData.markerNames = pData.markerNames[:0]
+	for i := range pData.validPhotos {
+		name := expandNameTemplate(tpl, i)
+		if name == "" {
+			name = photoHash(i)
+		}
+		pData.markerNames = append(pData.markerNames, uniqueName(name, used))
+	}
+}
+
+// copyTarget 一张需要转存的照片，name为有效照片或隐藏标记点照片在导入目录中的相对路径
+type copyTarget struct {
+	name     string
+	date     string
+	hash     string
+	copyName *string //转存后的文件名，命名后写回
+}
+
+// existingNames 读取目录中已有文件的文件名（不含扩展名，小写），目录不存在时返回空集合
+func existingNames(dir string) map[string]bool {
+	used := make(map[string]bool)
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		name := e.Name()
+		used[strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))] = true
+	}
+	return used
+}
+
+// assignCopyNames 为需要转存的照片生成转存后的文件名，包括隐藏标记点的照片。
+// 开启重命名时按模板命名，可用的占位符在标记点命名模板的基础上增加 {trip} 旅行名称、{seq} 按拍摄时间排列的序号；
+// 否则沿用原文件名。转存目录中已有同名文件时追加_2、_3……保证不会覆盖已有照片。
+// 开启保留子文件夹结构时，照片转存到转存目录下与导入目录中相同的子文件夹，转存后的文件名包含子文件夹
+func (t *TravelData) assignCopyNames(copyPath string, cfg *config.UserConfig) {
+	pData.copyNames = make([]string, len(pData.validPhotos))
+	var targets []copyTarget
+	for i, name := range pData.validPhotos {
+		targets = append(targets, copyTarget{name, pData.date[i], photoHash(i), &pData.copyNames[i]})
+	}
+	for i := range pData.hiddenPhotos {
+		h := &pData.hiddenPhotos[i]
+		targets = append(targets, copyTarget{h.name, h.date, h.hash, &h.copyName})
+	}
+
+	//按拍摄时间排序以生成序号，没有拍摄时间的照片排在最后
+	sort.SliceStable(targets, func(a, b int) bool {
+		ta, okA := parsePhotoTime(targets[a].date)
+		tb, okB := parsePhotoTime(targets[b].date)
+		if okA != okB {
+			return okA
+		}
+		if !ta.Equal(tb) {
+			return ta.Before(tb)
+		}
+		return targets[a].name < targets[b].name
+	})
+
+	tpl := cfg.PhotoName
+	if strings.TrimSpace(tpl) == "" {
+		tpl = defaultPhotoName
+	}
+	//各子文件夹中已使用的文件名，用到时才读取
+	used := make(map[string]map[string]bool)
+	for seq, target := range targets {
+		base := path.Base(target.name)
+		ext := filepath.Ext(base)
+		stem := strings.TrimSuffix(base, ext)
+		dir := "."
+		if cfg.MirrorFolders {
+			dir = path.Dir(target.name)
+		}
+		if used[dir] == nil {
+			used[dir] = existingNames(filepath.Join(copyPath, filepath.FromSlash(dir)))
+		}
+		if cfg.RenamePhoto {
+			r := templateReplacer(target.name, target.date, target.hash,
+				"{trip}", t.TravelName,
+				"{seq}", fmt.Sprintf("%03d", seq+1),
+			)
+			if name := sanitizeFileName(r.Replace(tpl)); name != "" {
+				stem = name
+			}
+		}
+		*target.copyName = path.Join(dir, uniqueName(stem, used[dir])+ext)
+	}
+}
+
+// photoName 获取第i张有效照片在笔记中引用的文件名。转存照片时为转存后的文件名，
+// 否则为原照片的文件名（不含子文件夹，子文件夹相对于导入目录而不是库，Obsidian无法按此解析）
+func photoName(i int) string {
+	if len(pData.copyNames) > i && pData.copyNames[i] != "" {
+		return pData.copyNames[i]
+	}
+	return path.Base(pData.validPhotos[i])
+}
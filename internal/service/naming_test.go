@@ -0,0 +1,183 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// setPhotos 将pData重置为只包含指定有效照片的状态，照片的坐标各不相同
+func setPhotos(names []string, dates []string) {
+	pData = photoData{}
+	for i, name := range names {
+		pData.validPhotos = append(pData.validPhotos, name)
+		pData.source = append(pData.source, 0)
+		pData.date = append(pData.date, dates[i])
+		pData.rawLocation = append(pData.rawLocation, location{39.9 + float64(i)/100, 116.3})
+		pData.convertedLocation = append(pData.convertedLocation, location{39.9 + float64(i)/100, 116.3})
+		pData.device = append(pData.device, "")
+		pData.altitude = append(pData.altitude, 0)
+		pData.orientation = append(pData.orientation, 1)
+	}
+	assignMarkerNames("{name}", nil)
+}
+
+func TestUniqueName(t *testing.T) {
+	tests := []struct {
+		name  string
+		taken []string
+		names []string
+		want  []string
+	}{
+		{"不重复", nil, []string{"a", "b"}, []string{"a", "b"}},
+		{"重复时追加序号", nil, []string{"a", "a", "a"}, []string{"a", "a_2", "a_3"}},
+		{"忽略大小写", nil, []string{"IMG", "img"}, []string{"IMG", "img_2"}},
+		{"序号与已有名称冲突", nil, []string{"a", "a_2", "a"}, []string{"a", "a_2", "a_3"}},
+		{"已被占用", []string{"a", "a_2"}, []string{"a"}, []string{"a_3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			used := make(map[string]bool)
+			for _, name := range tt.taken {
+				used[name] = true
+			}
+			var got []string
+			for _, name := range tt.names {
+				got = append(got, uniqueName(name, used))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("得到%v，应为%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"IMG_0001", "IMG_0001"},
+		{`a/b\c:d*e?f"g<h>i|j`, "a_b_c_d_e_f_g_h_i_j"},
+		{" 空格 ", "空格"},
+		{"tab\tname", "tab_name"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeFileName(tt.in); got != tt.want {
+			t.Errorf("sanitizeFileName(%q) = %q，应为%q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExpandNameTemplate(t *testing.T) {
+	setPhotos([]string{"2024/IMG_0001.jpg", "IMG_0002.jpg"}, []string{"2024-05-01 10:20:30", ""})
+	hash := photoHash(0)
+	tests := []struct {
+		tpl  string
+		i    int
+		want string
+	}{
+		{"{name}", 0, "IMG_0001"},
+		{"{date}_{time}", 0, "20240501_102030"},
+		{"{date}-{name}-{hash}", 0, "20240501-IMG_0001-" + hash},
+		{"{name}:{date}", 0, "IMG_0001_20240501"},
+		{"{date}_{time}", 1, "nodate_notime"},
+		{"固定名称", 1, "固定名称"},
+	}
+	for _, tt := range tests {
+		if got := expandNameTemplate(tt.tpl, tt.i); got != tt.want {
+			t.Errorf("expandNameTemplate(%q, %d) = %q，应为%q", tt.tpl, tt.i, got, tt.want)
+		}
+	}
+	if len(hash) != 8 || hash != photoHash(0) || hash == photoHash(1) {
+		t.Errorf("短哈希应为8位且同一照片结果相同、不同照片结果不同：%s %s", hash, photoHash(1))
+	}
+}
+
+func TestAssignMarkerNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		tpl   string
+		taken []string
+		want  []string
+	}{
+		{"默认模板", "", nil, []string{"IMG_0001", "IMG_0001_2", "IMG_0003"}},
+		{"按日期命名", "{date}", nil, []string{"20240501", "20240501_2", "20240502"}},
+		{"避开已有标记点", "{name}", []string{"img_0001"}, []string{"IMG_0001_2", "IMG_0001_3", "IMG_0003"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setPhotos([]string{"a/IMG_0001.jpg", "b/IMG_0001.jpg", "IMG_0003.jpg"},
+				[]string{"2024-05-01 10:00:00", "2024-05-01 11:00:00", "2024-05-02 09:00:00"})
+			assignMarkerNames(tt.tpl, tt.taken)
+			if !reflect.DeepEqual(pData.markerNames, tt.want) {
+				t.Errorf("得到%v，应为%v", pData.markerNames, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssignCopyNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.UserConfig
+		existing []string //转存目录中已有的文件
+		want     []string
+	}{
+		{
+			name: "沿用原文件名，重名时先拍摄的照片优先",
+			want: []string{"IMG_0001_2.jpg", "IMG_0001.jpg", "IMG_0003.jpg"},
+		},
+		{
+			name:     "不覆盖已有照片",
+			existing: []string{"IMG_0003.jpg"},
+			want:     []string{"IMG_0001_2.jpg", "IMG_0001.jpg", "IMG_0003_2.jpg"},
+		},
+		{
+			name: "按模板重命名，序号按拍摄时间排列",
+			cfg:  config.UserConfig{RenamePhoto: true, PhotoName: "{date}_{trip}_{seq}"},
+			want: []string{"20240501_旅行_002.jpg", "20240501_旅行_001.jpg", "nodate_旅行_003.jpg"},
+		},
+		{
+			name: "模板为空时使用默认模板",
+			cfg:  config.UserConfig{RenamePhoto: true, PhotoName: " "},
+			want: []string{"20240501_110000_旅行_002.jpg", "20240501_100000_旅行_001.jpg", "nodate_notime_旅行_003.jpg"},
+		},
+		{
+			name:     "保留子文件夹结构",
+			cfg:      config.UserConfig{MirrorFolders: true},
+			existing: []string{"a/IMG_0001.jpg"},
+			want:     []string{"a/IMG_0001_2.jpg", "b/IMG_0001.jpg", "IMG_0003.jpg"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tt.existing {
+				path := filepath.Join(dir, filepath.FromSlash(name))
+				os.MkdirAll(filepath.Dir(path), 0755)
+				os.WriteFile(path, nil, 0644)
+			}
+			setPhotos([]string{"a/IMG_0001.jpg", "b/IMG_0001.jpg", "IMG_0003.jpg"},
+				[]string{"2024-05-01 11:00:00", "2024-05-01 10:00:00", ""})
+			td := &TravelData{TravelName: "旅行"}
+			td.assignCopyNames(dir, &tt.cfg)
+			if !reflect.DeepEqual(pData.copyNames, tt.want) {
+				t.Errorf("得到%v，应为%v", pData.copyNames, tt.want)
+			}
+		})
+	}
+}
+
+func TestPhotoName(t *testing.T) {
+	setPhotos([]string{"sub/deep/a.jpg", "b.jpg", "sub/c.jpg"}, []string{"", "", ""})
+	pData.copyNames = []string{"", "", "sub/c_2.jpg"}
+	//未转存时引用原照片的文件名，转存时引用转存后的文件名
+	want := []string{"a.jpg", "b.jpg", "sub/c_2.jpg"}
+	for i := range want {
+		if got := photoName(i); got != want[i] {
+			t.Errorf("photoName(%d) = %q，应为%q", i, got, want[i])
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// PlannedFile 生成时将写入的文件
+type PlannedFile struct {
+	Path      string //文件路径
+	Overwrite bool   //文件已存在，生成时将被覆盖
+	Update    bool   //更新模式下只重写文件中生成的部分
+}
+
+// PlannedCopy 生成时将转存的照片
+type PlannedCopy struct {
+	Source string //原照片路径
+	Target string //转存路径。转存目录中已有内容相同的照片时，生成时会改为引用已有照片
+}
+
+// Plan 生成计划，列出生成时将进行的所有操作。制定计划时只读取照片和转换坐标，不会写入任何文件
+type Plan struct {
+	BasePath         string        //旅行记录文件夹
+	ValidPhotos      []string      //可以转换的照片
+	InvalidPhotos    []string      //无法转换的照片及原因
+	ExcludedPhotos   []string      //位于隐私区域内，被排除或隐藏标记点的照片
+	OutOfRangePhotos []string      //不在旅行日期内拍摄、被排除的照片
+	ExistingPhotos   []string      //更新模式下已在旅行记录中、将被跳过的照片
+	Update           bool          //是否以更新模式生成
+	Files            []PlannedFile //将创建或覆盖的笔记、标记点、缩略图等文件
+	Copies           []PlannedCopy //将转存的照片
+	Deletions        []string      //转存成功后将删除的原照片
+	EstimatedSize    int64         //预计写入的转存照片和缩略图总大小，单位字节
+	data             photoData     //制定计划时读取的照片数据，按计划生成时使用
+}
+
+// 制定计划和按计划生成都使用pData保存处理中的照片数据，同一时间只能进行其中一项
+var genMu sync.Mutex
+
+// PlanMD 读取照片并制定生成计划，不写入任何文件。之后可调用Execute按计划生成
+func (travelData *TravelData) PlanMD(cfg *config.UserConfig) (*Plan, error) {
+	genMu.Lock()
+	defer genMu.Unlock()
+	//清空上次生成的数据
+	pData = photoData{}
+	plan := &Plan{BasePath: filepath.Join(travelData.OutputPath, travelData.TravelName)}
+	//旅行记录已存在时才能更新，否则按新的旅行记录生成
+	plan.Update = travelData.Update && travelData.TripExists()
+	pData.update = plan.Update
+
+	//更新模式下读取已有的标记点，读取照片时跳过已有标记点的照片，只为新照片生成标记点
+	var markerNames []string
+	if plan.Update {
+		pData.existingMarkers = loadExistingMarkers(filepath.Join(plan.BasePath, "markers"))
+		for _, m := range pData.existingMarkers {
+			markerNames = append(markerNames, m.name)
+		}
+	}
+
+	//获取照片中的位置信息
+	if err := travelData.decodeEXIF(cfg); err != nil {
+		return nil, err
+	}
+	plan.OutOfRangePhotos = pData.outOfRange
+	plan.ExcludedPhotos = pData.excluded
+	plan.ExistingPhotos = pData.existingPhotos
+	//计算地图中心坐标和缩放级别
+	updateCenter()
+	//生成标记点文件名，不与已有标记点重名
+	assignMarkerNames(cfg.MarkerName, markerNames)
+	//生成转存照片的文件名
+	if cfg.MovePhoto {
+		travelData.assignCopyNames(copyDir(plan.BasePath, cfg), cfg)
+	}
+
+	plan.ValidPhotos = append([]string(nil), pData.validPhotos...)
+	for i, name := range pData.invalidPhotos {
+		plan.InvalidPhotos = append(plan.InvalidPhotos, name+"："+pData.invalidReasons[i])
+	}
+	travelData.planFiles(plan, cfg)
+	travelData.planCopies(plan, cfg)
+	plan.data = pData.clone()
+	return plan, nil
+}
+
+// planFiles 列出生成时将写入的笔记、路线、缩略图、标记点和额外导出文件，并估算缩略图大小
+func (travelData *TravelData) planFiles(plan *Plan, cfg *config.UserConfig) {
+	add := func(path string) {
+		_, err := os.Stat(path)
+		plan.Files = append(plan.Files, PlannedFile{Path: path, Overwrite: err == nil})
+	}
+
+	add(filepath.Join(plan.BasePath, travelData.TravelName+".md"))
+	plan.Files[0].Update = plan.Update
+	if cfg.DrawRoute && len(buildRoute(routePoints(), cfg.RouteColor, cfg.SplitRouteDay).Features) > 0 {
+		add(filepath.Join(plan.BasePath, routeFileName))
+	}
+	if cfg.MakeThumbnail {
+		size := cfg.ThumbnailSize
+		if size <= 0 {
+			size = defaultThumbnailSize
+		}
+		for i := range pData.validPhotos {
+			add(filepath.Join(plan.BasePath, "thumbnails", pData.markerNames[i]+"_thumb.jpg"))
+			if w, h, ok := photoDimensions(travelData.photoSource(i)); ok {
+				plan.EstimatedSize += estimateJPEGSize(w, h, thumbnailQuality, size)
+			}
+		}
+	}
+	for i := range pData.validPhotos {
+		add(filepath.Join(plan.BasePath, "markers", pData.markerNames[i]+".md"))
+	}
+	for _, format := range travelData.Exports {
+		add(filepath.Join(plan.BasePath, travelData.TravelName+"."+strings.ToLower(format)))
+	}
+}
+
+// planCopies 列出将转存和删除的照片，并估算转存后的大小
+func (travelData *TravelData) planCopies(plan *Plan, cfg *config.UserConfig) {
+	if !cfg.MovePhoto {
+		return
+	}
+	copyPath := copyDir(plan.BasePath, cfg)
+	var sources, targets []string
+	for i := range pData.validPhotos {
+		sources = append(sources, travelData.photoSource(i))
+		targets = append(targets, pData.copyNames[i])
+	}
+	for _, h := range pData.hiddenPhotos {
+		sources = append(sources, travelData.sourcePath(h.source, h.name))
+		targets = append(targets, h.copyName)
+	}
+
+	for i, src := range sources {
+		plan.Copies = append(plan.Copies, PlannedCopy{Source: src, Target: filepath.Join(copyPath, filepath.FromSlash(targets[i]))})
+		if cfg.DeletePhoto {
+			plan.Deletions = append(plan.Deletions, src)
+		}
+		plan.EstimatedSize += estimateCopySize(src, cfg)
+	}
+}
+
+// photoDimensions 读取照片的宽高，不解码整张图片
+func photoDimensions(path string) (int, int, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, false
+	}
+	defer file.Close()
+	imgCfg, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0, false
+	}
+	return imgCfg.Width, imgCfg.Height, true
+}
+
+// estimateCopySize 估算一张照片转存后的大小。不需要压缩时即为原照片大小
+func estimateCopySize(src string, cfg *config.UserConfig) int64 {
+	file, err := os.Open(src)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+	if !needReencode(file, cfg) {
+		if info, err := file.Stat(); err == nil {
+			return info.Size()
+		}
+		return 0
+	}
+	if w, h, ok := photoDimensions(src); ok {
+		return estimateJPEGSize(w, h, cfg.PhotoQuality, cfg.PhotoMaxEdge)
+	}
+	return 0
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"MapPhotoMD/internal/model"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newConvertServer 模拟高德坐标转换接口，原样返回请求的坐标
+func newConvertServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"status":"1","info":"ok","locations":"%s"}`, r.URL.Query().Get("locations"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPlanAndExecute(t *testing.T) {
+	dir := chdirTemp(t)
+	in := filepath.Join(dir, "in")
+	writeJPEG(t, in, "a.jpg", testPhoto{date: "2024:05:01 10:00:00", lat: 39.9, long: 116.3})
+	writeJPEG(t, in, "b.jpg", testPhoto{date: "2024:05:01 11:00:00", lat: 39.91, long: 116.31})
+	writeTestJPEG(t, in, "nogps.jpg")
+
+	cfg := config.NewUserConfig()
+	cfg.AmapBaseURL = newConvertServer(t).URL
+	cfg.MovePhoto = true
+	cfg.DeletePhoto = true
+	cfg.DeletedPath = filepath.Join(dir, "deleted")
+	td := &TravelData{TravelName: "trip", Inputs: []*model.InputSourceData{{Path: in}}, OutputPath: filepath.Join(dir, "out"), Exports: []string{Export_GPX}}
+
+	plan, err := td.PlanMD(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//制定计划时不写入任何文件
+	if exists(td.OutputPath) {
+		t.Fatalf("制定计划时不应创建旅行记录文件夹")
+	}
+	if len(plan.ValidPhotos) != 2 || len(plan.InvalidPhotos) != 1 || !strings.HasPrefix(plan.InvalidPhotos[0], "nogps.jpg：") {
+		t.Errorf("有效照片为%v，无效照片为%v", plan.ValidPhotos, plan.InvalidPhotos)
+	}
+	//旅行记录、两个标记点和GPX
+	if len(plan.Files) != 4 {
+		t.Errorf("将写入的文件为%+v", plan.Files)
+	}
+	if len(plan.Copies) != 2 || plan.Copies[0].Target != filepath.Join(plan.BasePath, "pictures", "a.jpg") || len(plan.Deletions) != 2 {
+		t.Errorf("将转存的照片为%+v，将删除的照片为%v", plan.Copies, plan.Deletions)
+	}
+	if plan.EstimatedSize <= 0 {
+		t.Errorf("预计大小为%d", plan.EstimatedSize)
+	}
+
+	//按计划生成后，计划中的文件都已写入
+	report := td.Execute(plan, cfg)
+	if len(report.ExportErrors) != 0 || len(report.CopyFailed) != 0 || len(report.DeleteFailed) != 0 {
+		t.Fatalf("生成结果为%+v", report)
+	}
+	for _, f := range plan.Files {
+		if !exists(f.Path) {
+			t.Errorf("未写入%s", f.Path)
+		}
+	}
+	for _, c := range plan.Copies {
+		if !exists(c.Target) {
+			t.Errorf("未转存%s", c.Target)
+		}
+	}
+	for _, path := range plan.Deletions {
+		if exists(path) {
+			t.Errorf("未删除%s", path)
+		}
+	}
+}
+
+func TestExecuteUsesPlanData(t *testing.T) {
+	dir := chdirTemp(t)
+	cfg := config.NewUserConfig()
+	cfg.AmapBaseURL = newConvertServer(t).URL
+	var tds []*TravelData
+	var plans []*Plan
+	for _, name := range []string{"a", "b"} {
+		in := filepath.Join(dir, name)
+		writeJPEG(t, in, name+".jpg", testPhoto{date: "2024:05:01 10:00:00", lat: 39.9, long: 116.3})
+		td := &TravelData{TravelName: "trip_" + name, Inputs: []*model.InputSourceData{{Path: in}}, OutputPath: filepath.Join(dir, "out")}
+		plan, err := td.PlanMD(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tds = append(tds, td)
+		plans = append(plans, plan)
+	}
+
+	//先制定的计划在另一次制定计划之后执行，仍按自己读取的照片生成
+	for i, name := range []string{"a", "b"} {
+		tds[i].Execute(plans[i], cfg)
+		marker := filepath.Join(plans[i].BasePath, "markers", name+".md")
+		if !exists(marker) {
+			t.Errorf("未按计划写入%s", marker)
+		}
+		other := filepath.Join(plans[i].BasePath, "markers", []string{"b", "a"}[i]+".md")
+		if exists(other) {
+			t.Errorf("不应写入其他计划的标记点%s", other)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// 删除原照片的记录文件，与配置文件放在同一目录下，用于恢复照片
+const deletedLogFile = "deleted_photos.json"
+
+// 默认的原照片暂存目录，与配置文件放在同一目录下
+const defaultDeletedPath = "deleted_photos"
+
+// deletedPhoto 一张被删除（移走）的原照片
+type deletedPhoto struct {
+	Original  string `json:"original"`             //原路径
+	Stored    string `json:"stored"`               //移动到的路径
+	TrashInfo string `json:"trash_info,omitempty"` //回收站中的.trashinfo文件，只在移到回收站时有值
+	Batch     string `json:"batch"`                //删除批次，同一次生成中删除的照片批次相同
+}
+
+// loadDeletedLog 读取删除记录，文件不存在或损坏时返回空记录
+func loadDeletedLog() []deletedPhoto {
+	var records []deletedPhoto
+	data, err := os.ReadFile(statePath(deletedLogFile))
+	if err != nil {
+		return nil
+	}
+	json.Unmarshal(data, &records)
+	return records
+}
+
+// saveDeletedLog 保存删除记录
+func saveDeletedLog(records []deletedPhoto) error {
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(statePath(deletedLogFile), data, 0644)
+}
+
+// fileHash 计算文件内容的SHA-256
+func fileHash(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return contentHash(data), nil
+}
+
+// moveFile 移动文件。无法直接重命名时（如跨磁盘），先复制并校验内容，再删除原文件
+func moveFile(src string, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := writeFileSync(dst, data); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	if hash, err := fileHash(dst); err != nil || hash != contentHash(data) {
+		os.Remove(dst)
+		return errors.New("复制后校验失败")
+	}
+	return os.Remove(src)
+}
+
+// uniquePath 在目录dir中为文件name生成不重复的路径，已存在时追加_2、_3……
+func uniquePath(dir string, name string) string {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	return filepath.Join(dir, uniqueName(stem, existingNames(dir))+ext)
+}
+
+// trashDir 获取freedesktop回收站目录（$XDG_DATA_HOME/Trash），非Linux系统时返回false
+func trashDir() (string, bool) {
+	if runtime.GOOS != "linux" {
+		return "", false
+	}
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", false
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "Trash"), true
+}
+
+// moveToTrash 按freedesktop回收站规范将文件移到回收站，返回文件在回收站中的路径和对应的.trashinfo文件
+func moveToTrash(path string, trash string, now time.Time) (stored string, info string, err error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", "", err
+	}
+	filesDir := filepath.Join(trash, "files")
+	infoDir := filepath.Join(trash, "info")
+	if err := os.MkdirAll(filesDir, 0700); err != nil {
+		return "", "", err
+	}
+	if err := os.MkdirAll(infoDir, 0700); err != nil {
+		return "", "", err
+	}
+
+	//先写入.trashinfo，再移动文件，以免文件移走后无法记录其原路径
+	stored = uniquePath(filesDir, filepath.Base(abs))
+	info = filepath.Join(infoDir, filepath.Base(stored)+".trashinfo")
+	content := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: abs}).EscapedPath(), now.Format("2006-01-02T15:04:05"))
+	if err := os.WriteFile(info, []byte(content), 0600); err != nil {
+		return "", "", err
+	}
+	if err := moveFile(abs, stored); err != nil {
+		os.Remove(info)
+		return "", "", err
+	}
+	return stored, info, nil
+}
+
+// batchID 按删除时间生成删除批次，精确到纳秒。与删除记录中已有的批次相同时追加_2、_3……，
+// 以免同一时间的两次生成（如脚本连续调用命令行）在恢复时互相影响
+func batchID(records []deletedPhoto, now time.Time) string {
+	used := make(map[string]bool)
+	for _, r := range records {
+		used[r.Batch] = true
+	}
+	batch := now.Format("2006-01-02 15:04:05.000000000")
+	for i := 2; used[batch]; i++ {
+		batch = fmt.Sprintf("%s_%d", now.Format("2006-01-02 15:04:05.000000000"), i)
+	}
+	return batch
+}
+
+// recyclePhotos 将原照片移到暂存目录或回收站，而不是直接删除，并记录到删除记录中以便恢复。
+// 返回移走的照片和无法移动的照片及原因
+func recyclePhotos(paths []string, cfg *config.UserConfig) ([]deletedPhoto, []string) {
+	var moved []deletedPhoto
+	var failed []string
+	now := time.Now()
+	records := loadDeletedLog()
+	batch := batchID(records, now)
+
+	trash, useTrash := trashDir()
+	useTrash = useTrash && cfg.DeleteTo == config.DeleteTo_Trash
+	holding := cfg.DeletedPath
+	if holding == "" {
+		holding = defaultDeletedPath
+	}
+	holding = statePath(holding)
+
+	for _, path := range paths {
+		record := deletedPhoto{Original: path, Batch: batch}
+		var err error
+		if useTrash {
+			record.Stored, record.TrashInfo, err = moveToTrash(path, trash, now)
+		} else {
+			if err = os.MkdirAll(holding, 0755); err == nil {
+				record.Stored = uniquePath(holding, filepath.Base(path))
+				err = moveFile(path, record.Stored)
+			}
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s：%v", filepath.Base(path), err))
+			continue
+		}
+		if abs, err := filepath.Abs(record.Original); err == nil {
+			record.Original = abs
+		}
+		if abs, err := filepath.Abs(record.Stored); err == nil {
+			record.Stored = abs
+		}
+		records = append(records, record)
+		moved = append(moved, record)
+	}
+	if err := saveDeletedLog(records); err != nil {
+		failed = append(failed, fmt.Sprintf("%s：%v", deletedLogFile, err))
+	}
+	return moved, failed
+}
+
+// RestoreDeletedPhotos 将最近一次生成时删除的原照片移回原位置。原位置已有同名文件时跳过。
+// 返回恢复的照片数量和无法恢复的照片及原因
+func RestoreDeletedPhotos() (int, []string) {
+	records := loadDeletedLog()
+	if len(records) == 0 {
+		return 0, nil
+	}
+	return restoreBatch(records[len(records)-1].Batch)
+}
+
+// restoreBatch 将指定批次删除的原照片移回原位置，返回恢复的照片数量和无法恢复的照片及原因
+func restoreBatch(batch string) (int, []string) {
+	records := loadDeletedLog()
+	restored := 0
+	var failed []string
+	var remain []deletedPhoto
+	for _, r := range records {
+		if r.Batch != batch {
+			remain = append(remain, r)
+			continue
+		}
+		name := filepath.Base(r.Original)
+		if _, err := os.Stat(r.Original); err == nil {
+			failed = append(failed, name+"：原位置已有同名文件")
+			remain = append(remain, r)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(r.Original), 0755); err != nil {
+			failed = append(failed, fmt.Sprintf("%s：%v", name, err))
+			remain = append(remain, r)
+			continue
+		}
+		if err := moveFile(r.Stored, r.Original); err != nil {
+			//暂存的照片已被清理时不再保留记录
+			if errors.Is(err, os.ErrNotExist) {
+				failed = append(failed, name+"：暂存的照片已不存在")
+			} else {
+				failed = append(failed, fmt.Sprintf("%s：%v", name, err))
+				remain = append(remain, r)
+			}
+			continue
+		}
+		if r.TrashInfo != "" {
+			os.Remove(r.TrashInfo)
+		}
+		restored++
+	}
+	if err := saveDeletedLog(remain); err != nil {
+		failed = append(failed, fmt.Sprintf("%s：%v", deletedLogFile, err))
+	}
+	return restored, failed
+}
+
+// sameFile 判断两个路径是否指向同一个文件
+func sameFile(a string, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
+// copyVerified 检查转存后的文件内容是否与预期一致
+func copyVerified(path string, data []byte) error {
+	hash, err := fileHash(path)
+	if err != nil {
+		return err
+	}
+	if hash != contentHash(data) {
+		return errors.New("转存后的文件与原照片不一致")
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readText 读取文件内容，文件不存在时返回空字符串
+func readText(path string) string {
+	data, _ := os.ReadFile(path)
+	return string(data)
+}
+
+// exists 判断路径是否存在
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestBatchID(t *testing.T) {
+	now := time.Date(2024, 5, 1, 10, 0, 0, 123, time.Local)
+	first := batchID(nil, now)
+	records := []deletedPhoto{{Batch: first}}
+	second := batchID(records, now)
+	records = append(records, deletedPhoto{Batch: second})
+	third := batchID(records, now)
+	if first == second || second == third || first == third {
+		t.Errorf("同一时间的批次应各不相同：%s %s %s", first, second, third)
+	}
+	if other := batchID(records, now.Add(time.Nanosecond)); other == first {
+		t.Errorf("不同时间的批次应不同")
+	}
+}
+
+func TestRestoreOnlyLastBatch(t *testing.T) {
+	dir := chdirTemp(t)
+	cfg := &config.UserConfig{DeleteTo: config.DeleteTo_Folder, DeletedPath: filepath.Join(dir, "holding")}
+	in := filepath.Join(dir, "in")
+	os.MkdirAll(in, 0755)
+	first := filepath.Join(in, "a.jpg")
+	second := filepath.Join(in, "b.jpg")
+	os.WriteFile(first, []byte("a"), 0644)
+	os.WriteFile(second, []byte("b"), 0644)
+
+	//连续两次删除，模拟脚本在同一秒内连续生成
+	if _, failed := recyclePhotos([]string{first}, cfg); len(failed) != 0 {
+		t.Fatal(failed)
+	}
+	moved, failed := recyclePhotos([]string{second}, cfg)
+	if len(failed) != 0 {
+		t.Fatal(failed)
+	}
+	if exists(first) || exists(second) {
+		t.Fatalf("原照片应已移走")
+	}
+
+	restored, failed := RestoreDeletedPhotos()
+	if restored != 1 || len(failed) != 0 {
+		t.Fatalf("恢复了%d张照片，失败%v，应只恢复最近一次删除的1张", restored, failed)
+	}
+	if exists(first) || readText(second) != "b" {
+		t.Errorf("应只恢复最近一次删除的照片")
+	}
+	if records := loadDeletedLog(); len(records) != 1 || records[0].Batch == moved[0].Batch {
+		t.Errorf("删除记录中应只剩第一次删除的照片：%+v", records)
+	}
+
+	//原位置已有同名文件时不覆盖
+	os.WriteFile(first, []byte("新照片"), 0644)
+	restored, failed = RestoreDeletedPhotos()
+	if restored != 0 || len(failed) != 1 || readText(first) != "新照片" {
+		t.Errorf("原位置已有同名文件时应跳过：%d %v", restored, failed)
+	}
+	if len(loadDeletedLog()) != 1 {
+		t.Errorf("未能恢复的照片应保留在删除记录中")
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// listPhotos 按用户设置列出导入目录中需要读取的照片，返回以/分隔的相对路径。
+// 无法读取的子文件夹会被跳过，导入目录本身无法读取时返回错误
+func listPhotos(root string, cfg *config.UserConfig) ([]string, error) {
+	var photos []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		rel, relErr := filepath.Rel(root, p)
+		if relErr != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if err != nil {
+			if rel == "." {
+				return err
+			}
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if rel == "." {
+			return nil
+		}
+		if d.IsDir() {
+			if !scanFolder(rel, cfg) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if scanFile(rel, cfg) {
+			photos = append(photos, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取导入目录失败：%v", err)
+	}
+	return photos, nil
+}
+
+// scanFolder 判断是否读取子文件夹rel，超过设置的层数、隐藏或匹配排除规则时不读取
+func scanFolder(rel string, cfg *config.UserConfig) bool {
+	depth := strings.Count(rel, "/") + 1
+	if cfg.ScanDepth >= 0 && depth > cfg.ScanDepth {
+		return false
+	}
+	if cfg.SkipHidden && strings.HasPrefix(path.Base(rel), ".") {
+		return false
+	}
+	return !matchAny(cfg.ExcludeGlobs, rel)
+}
+
+// scanFile 判断是否读取照片rel，只读取jpg格式、未隐藏、匹配包含规则且不匹配排除规则的文件
+func scanFile(rel string, cfg *config.UserConfig) bool {
+	if path.Ext(rel) != ".jpg" { //只读取jpg格式的文件
+		return false
+	}
+	if cfg.SkipHidden && strings.HasPrefix(path.Base(rel), ".") {
+		return false
+	}
+	if len(cfg.IncludeGlobs) > 0 && !matchAny(cfg.IncludeGlobs, rel) {
+		return false
+	}
+	return !matchAny(cfg.ExcludeGlobs, rel)
+}
+
+// matchAny 判断相对路径rel是否匹配任意一条规则。规则不含/时只与文件名或文件夹名比较，
+// 否则与完整的相对路径比较，如 2024*/DCIM/*。比较时忽略大小写，格式错误的规则不匹配任何路径
+func matchAny(patterns []string, rel string) bool {
+	rel = strings.ToLower(rel)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.Trim(filepath.ToSlash(strings.TrimSpace(pattern)), "/"))
+		if pattern == "" {
+			continue
+		}
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckGlobs 检查包含、排除规则的格式，返回第一条格式错误的规则
+func CheckGlobs(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(strings.ToLower(filepath.ToSlash(strings.TrimSpace(pattern))), ""); err != nil {
+			return fmt.Errorf("规则格式错误：%s", pattern)
+		}
+	}
+	return nil
+}
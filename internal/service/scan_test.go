@@ -0,0 +1,86 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestListPhotos(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{
+		"a.jpg", "b.png", ".hidden.jpg",
+		"sub/c.jpg", "sub/IMG_0001.jpg",
+		"sub/deep/d.jpg",
+		".thumbs/e.jpg",
+		"Screenshots/f.jpg",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, nil, 0644)
+	}
+	tests := []struct {
+		name string
+		cfg  config.UserConfig
+		want []string
+	}{
+		{"不限层数，跳过隐藏", config.UserConfig{ScanDepth: -1, SkipHidden: true},
+			[]string{"Screenshots/f.jpg", "a.jpg", "sub/IMG_0001.jpg", "sub/c.jpg", "sub/deep/d.jpg"}},
+		{"只读取导入目录", config.UserConfig{ScanDepth: 0, SkipHidden: true}, []string{"a.jpg"}},
+		{"读取一层子文件夹", config.UserConfig{ScanDepth: 1, SkipHidden: true},
+			[]string{"Screenshots/f.jpg", "a.jpg", "sub/IMG_0001.jpg", "sub/c.jpg"}},
+		{"读取隐藏文件", config.UserConfig{ScanDepth: -1},
+			[]string{".hidden.jpg", ".thumbs/e.jpg", "Screenshots/f.jpg", "a.jpg", "sub/IMG_0001.jpg", "sub/c.jpg", "sub/deep/d.jpg"}},
+		{"包含规则", config.UserConfig{ScanDepth: -1, SkipHidden: true, IncludeGlobs: []string{"img_*"}},
+			[]string{"sub/IMG_0001.jpg"}},
+		{"排除文件夹", config.UserConfig{ScanDepth: -1, SkipHidden: true, ExcludeGlobs: []string{"Screenshots", "sub/deep"}},
+			[]string{"a.jpg", "sub/IMG_0001.jpg", "sub/c.jpg"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := listPhotos(root, &tt.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("得到%v，应为%v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := listPhotos(filepath.Join(root, "missing"), &config.UserConfig{ScanDepth: -1}); err == nil {
+		t.Errorf("导入目录不存在时应返回错误")
+	}
+}
+
+func TestMatchAny(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		rel      string
+		want     bool
+	}{
+		{[]string{"IMG_*"}, "2024/img_0001.jpg", true},
+		{[]string{"screenshots"}, "Screenshots", true},
+		{[]string{"2024*/DCIM/*"}, "2024-05/DCIM/a.jpg", true},
+		{[]string{"2024*/DCIM/*"}, "DCIM/a.jpg", false},
+		{[]string{" /Camera/ "}, "Camera", true},
+		{[]string{"", "["}, "a.jpg", false},
+		{nil, "a.jpg", false},
+	}
+	for _, tt := range tests {
+		if got := matchAny(tt.patterns, tt.rel); got != tt.want {
+			t.Errorf("matchAny(%q, %q) = %v，应为%v", tt.patterns, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestCheckGlobs(t *testing.T) {
+	if err := CheckGlobs([]string{"IMG_*", "2024*/DCIM/*", ""}); err != nil {
+		t.Errorf("规则格式正确时不应返回错误：%v", err)
+	}
+	if err := CheckGlobs([]string{"IMG_*", "[a"}); err == nil {
+		t.Errorf("规则格式错误时应返回错误")
+	}
+}
@@ -0,0 +1,22 @@
+package service
+
+import "path/filepath"
+
+// stateDir 删除记录、生成记录、逆地理编码缓存等数据文件所在的目录，为空时使用当前目录（图形界面的配置文件目录）
+var stateDir string
+
+// SetStateDir 设置数据文件所在的目录，命令行指定的配置文件不在当前目录时，数据文件与配置文件放在同一目录
+func SetStateDir(dir string) {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	stateDir = dir
+}
+
+// statePath 获取数据文件的路径，相对路径相对于数据文件目录
+func statePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(stateDir, path)
+}
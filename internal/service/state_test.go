@@ -0,0 +1,54 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStateDir(t *testing.T) {
+	wd := chdirTemp(t)
+	dir := t.TempDir()
+	SetStateDir(dir)
+	t.Cleanup(func() { stateDir = "" })
+
+	//离线数据集的默认位置在数据文件目录下
+	os.MkdirAll(filepath.Join(dir, defaultGeoDataPath), 0755)
+	for name, content := range testGeoData {
+		os.WriteFile(filepath.Join(dir, defaultGeoDataPath, name), []byte(content), 0644)
+	}
+	if _, err := loadOfflineGeocoder(""); err != nil {
+		t.Errorf("应从数据文件目录读取离线数据集：%v", err)
+	}
+
+	photo := filepath.Join(wd, "a.jpg")
+	os.WriteFile(photo, []byte("a"), 0644)
+	if _, failed := recyclePhotos([]string{photo}, &config.UserConfig{DeleteTo: config.DeleteTo_Folder}); len(failed) != 0 {
+		t.Fatal(failed)
+	}
+	if err := saveGeocodeCache(map[string]place{"116.30000,39.90000": {City: "北京市"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveHistory([]string{"manifest.json"}); err != nil {
+		t.Fatal(err)
+	}
+
+	//数据文件写入数据文件目录，而不是当前目录
+	for _, name := range []string{deletedLogFile, geocodeCacheFile, historyFile, filepath.Join(defaultDeletedPath, "a.jpg")} {
+		if !exists(filepath.Join(dir, name)) {
+			t.Errorf("%s应保存在数据文件目录下", name)
+		}
+		if exists(filepath.Join(wd, name)) {
+			t.Errorf("%s不应保存在当前目录下", name)
+		}
+	}
+	if len(loadDeletedLog()) != 1 || loadGeocodeCache()["116.30000,39.90000"].City != "北京市" || len(loadHistory()) != 1 {
+		t.Errorf("应从数据文件目录读取数据文件")
+	}
+
+	//绝对路径不受数据文件目录影响
+	if got := statePath(wd); got != wd {
+		t.Errorf("statePath(%q) = %q", wd, got)
+	}
+}
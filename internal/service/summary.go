@@ -0,0 +1,119 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"fmt"
+	"strings"
+)
+
+// Summary 生成计划的文字说明，将被覆盖的文件列在将创建的文件之前，便于检查
+func (plan *Plan) Summary() string {
+	var b strings.Builder
+	//写入一组列表，列表为空时不写入
+	writeList := func(title string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		b.WriteString(title + "\n")
+		for _, item := range items {
+			b.WriteString("  " + item + "\n")
+		}
+	}
+
+	b.WriteString("旅行记录文件夹：" + plan.BasePath + "\n")
+	if plan.Update {
+		b.WriteString("更新模式：只添加新照片，保留旅行记录中手写的内容\n")
+	}
+	b.WriteString(fmt.Sprintf("可以转换的照片：%d张\n", len(plan.ValidPhotos)))
+	writeList("无法转换的照片：", plan.InvalidPhotos)
+	writeList("不在旅行日期内拍摄、将排除的照片：", plan.OutOfRangePhotos)
+	writeList("位于隐私区域内的照片：", plan.ExcludedPhotos)
+	writeList("已在旅行记录中、将跳过的照片：", plan.ExistingPhotos)
+
+	var created, overwritten, updated []string
+	for _, f := range plan.Files {
+		switch {
+		case f.Update:
+			updated = append(updated, f.Path)
+		case f.Overwrite:
+			overwritten = append(overwritten, f.Path)
+		default:
+			created = append(created, f.Path)
+		}
+	}
+	writeList("只更新地图部分的文件：", updated)
+	writeList(fmt.Sprintf("将覆盖的文件（%d个）：", len(overwritten)), overwritten)
+	writeList(fmt.Sprintf("将创建的文件（%d个）：", len(created)), created)
+
+	var copies []string
+	for _, c := range plan.Copies {
+		copies = append(copies, c.Source+" → "+c.Target)
+	}
+	writeList(fmt.Sprintf("将转存的照片（%d张）：", len(copies)), copies)
+	writeList(fmt.Sprintf("转存成功后将删除的原照片（%d张，可恢复）：", len(plan.Deletions)), plan.Deletions)
+	b.WriteString(fmt.Sprintf("预计照片和缩略图共占用：%.1f MB\n", float64(plan.EstimatedSize)/1024/1024))
+	return b.String()
+}
+
+// Summary 生成结果的文字说明，没有需要提示的内容时返回空字符串
+func (report *Report) Summary(cfg *config.UserConfig) string {
+	str := ""
+	//显示无法转换的照片
+	if len(report.InvalidPhotos) != 0 {
+		str = str + "无法转换的照片如下，请检查其是否存在经纬度信息：\n"
+		for _, p := range report.InvalidPhotos {
+			str = str + p + "\n"
+		}
+	}
+	//显示转存失败的照片
+	if len(report.CopyFailed) != 0 {
+		str = str + "以下照片转存失败，原照片未删除：\n"
+		for _, e := range report.CopyFailed {
+			str = str + e + "\n"
+		}
+	}
+	//显示删除失败的原照片
+	if len(report.DeleteFailed) != 0 {
+		str = str + "以下原照片删除失败：\n"
+		for _, e := range report.DeleteFailed {
+			str = str + e + "\n"
+		}
+	}
+	//显示去重的照片数量
+	if report.Deduplicated != 0 {
+		str = str + fmt.Sprintf("转存目录中已有%d张内容相同的照片，未重复保存\n", report.Deduplicated)
+	}
+	//显示不在旅行日期内拍摄的照片
+	if len(report.OutOfRangePhotos) != 0 {
+		str = str + "以下照片不在旅行日期内拍摄，已排除：\n"
+		for _, p := range report.OutOfRangePhotos {
+			str = str + p + "\n"
+		}
+	}
+	//显示位于隐私区域内的照片
+	if len(report.ExcludedPhotos) != 0 {
+		if cfg.GeofenceMode == config.Geofence_HideMarker {
+			str = str + "以下照片位于隐私区域内，已隐藏其标记点：\n"
+		} else {
+			str = str + "以下照片位于隐私区域内，已排除：\n"
+		}
+		for _, p := range report.ExcludedPhotos {
+			str = str + p + "\n"
+		}
+	}
+	//显示逆地理编码失败的照片
+	if len(report.GeocodeFailed) != 0 {
+		str = str + "以下照片未能获取地点名称，请检查高德Key、网络或离线数据集：\n"
+		for _, p := range report.GeocodeFailed {
+			str = str + p + "\n"
+		}
+	}
+	//显示导出失败的格式
+	if len(report.ExportErrors) != 0 {
+		str = str + "以下格式导出失败：\n"
+		for _, e := range report.ExportErrors {
+			str = str + e + "\n"
+		}
+	}
+	return str
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"strings"
+	"testing"
+)
+
+func TestPlanSummary(t *testing.T) {
+	plan := &Plan{
+		BasePath:    "out/trip",
+		ValidPhotos: []string{"a.jpg", "b.jpg"},
+		Files: []PlannedFile{
+			{Path: "out/trip/markers/a.md"},
+			{Path: "out/trip/trip.md", Overwrite: true},
+		},
+		Copies:    []PlannedCopy{{Source: "in/a.jpg", Target: "photos/a.jpg"}},
+		Deletions: []string{"in/a.jpg"},
+	}
+	s := plan.Summary()
+	for _, want := range []string{"可以转换的照片：2张", "将覆盖的文件（1个）：\n  out/trip/trip.md", "将创建的文件（1个）：\n  out/trip/markers/a.md", "in/a.jpg → photos/a.jpg"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("计划说明中缺少%q：\n%s", want, s)
+		}
+	}
+	//被覆盖的文件列在将创建的文件之前
+	if strings.Index(s, "将覆盖的文件") > strings.Index(s, "将创建的文件") {
+		t.Errorf("被覆盖的文件应列在前面：\n%s", s)
+	}
+	if strings.Contains(s, "无法转换的照片") || strings.Contains(s, "更新模式") {
+		t.Errorf("列表为空或不是更新模式时不应写入：\n%s", s)
+	}
+}
+
+func TestReportSummary(t *testing.T) {
+	if s := (&Report{}).Summary(&config.UserConfig{}); s != "" {
+		t.Errorf("没有需要提示的内容时应为空：%q", s)
+	}
+	report := &Report{ExcludedPhotos: []string{"home.jpg（家）"}, Deduplicated: 2}
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{config.Geofence_Exclude, "以下照片位于隐私区域内，已排除：\nhome.jpg（家）\n"},
+		{config.Geofence_HideMarker, "以下照片位于隐私区域内，已隐藏其标记点：\nhome.jpg（家）\n"},
+	}
+	for _, tt := range tests {
+		s := report.Summary(&config.UserConfig{GeofenceMode: tt.mode})
+		if !strings.Contains(s, tt.want) || !strings.Contains(s, "已有2张内容相同的照片") {
+			t.Errorf("隐私区域模式为%s时结果说明为：\n%s", tt.mode, s)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"os"
+	"path/filepath"
+)
+
+// 缩略图的JPEG质量
+const thumbnailQuality = 80
+
+// 缩略图的默认最大长边像素
+const defaultThumbnailSize = 320
+
+// makeThumbnails 按用户设置，在旅行记录文件夹的thumbnails目录下为每张有效照片生成缩略图，
+// 文件名记录到pData.thumbnails，未生成时为空
+func (t *TravelData) makeThumbnails(basePath string, cfg *config.UserConfig) {
+	pData.thumbnails = make([]string, len(pData.validPhotos))
+	if !cfg.MakeThumbnail {
+		return
+	}
+	size := cfg.ThumbnailSize
+	if size <= 0 {
+		size = defaultThumbnailSize
+	}
+
+	thumbPath := filepath.Join(basePath, "thumbnails")
+	os.MkdirAll(thumbPath, 0755)
+	for i := range pData.validPhotos {
+		data, err := downscaledJPEG(t.photoSource(i), size, thumbnailQuality, pData.orientation[i])
+		if err != nil {
+			continue
+		}
+		name := pData.markerNames[i] + "_thumb.jpg"
+		if err := writeFile(filepath.Join(thumbPath, name), data); err != nil {
+			continue
+		}
+		pData.thumbnails[i] = name
+	}
+}
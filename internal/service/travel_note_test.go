@@ -0,0 +1,88 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"MapPhotoMD/internal/model"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 运行 go test -run TestMakeTravelNote -update 以重新生成testdata中的期望结果
+var updateGolden = flag.Bool("update", false, "重新生成testdata中的期望结果")
+
+func TestMakeTravelNote(t *testing.T) {
+	properties := []*model.PropertyData{
+		{Type: model.ProType_Tag, Name: "tags", Value: "旅行"},
+		{Type: model.ProType_List, Name: "companions", Value: "小明,小红"},
+	}
+	cfg := &config.UserConfig{NotePath: "旅行记录", RouteColor: "#3388ff"}
+	tests := []struct {
+		name   string
+		golden string
+		td     TravelData
+		setup  func()
+		old    string //更新模式下已有的旅行记录，为空时不是更新模式
+	}{
+		{
+			name:   "只有属性和地图",
+			golden: "note_basic.md",
+			td:     TravelData{TravelName: "北京", TravelDate: "2024-05-01", Properties: properties},
+			setup:  func() {},
+		},
+		{
+			name:   "结束日期、到访地点和旅行路线",
+			golden: "note_full.md",
+			td:     TravelData{TravelName: "北京", TravelDate: "2024-05-01", TravelEndDate: "2024-05-03", Properties: properties},
+			setup: func() {
+				pData.places = []place{
+					{Country: "中国", Province: "北京市", City: "北京市"},
+					{Country: "中国", Province: "河北省", City: "保定市"},
+				}
+				pData.routeFile = routeFileName
+			},
+		},
+		{
+			name:   "更新模式只替换地图部分",
+			golden: "note_update.md",
+			td:     TravelData{TravelName: "北京", TravelDate: "2024-05-01", Properties: properties},
+			setup:  func() { pData.update = true },
+			old:    "---\ntags: 旅行\n---\n\n手写的游记\n\n" + regionBegin + "\n```leaflet\nid: 旧地图\n```\n" + regionEnd + "\n\n结尾的游记\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setPhotos([]string{"a.jpg", "b.jpg"}, []string{"2024-05-01 10:00:00", "2024-05-02 10:00:00"})
+			pData.centerLocation = location{39.905, 116.3}
+			pData.places = make([]place, len(pData.validPhotos)) //未开启逆地理编码时地点为空
+			pData.zoom = 13
+			tt.setup()
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, tt.td.TravelName+".md")
+			if tt.old != "" {
+				os.WriteFile(path, []byte(tt.old), 0644)
+			}
+			tt.td.makeTravelNote(dir, cfg)
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", tt.golden)
+			if *updateGolden {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("旅行记录与%s不同：\n%s", golden, got)
+			}
+		})
+	}
+}
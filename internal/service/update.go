@@ -0,0 +1,220 @@
+package service
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 旅行记录中由程序生成的部分的起止标记，使用Obsidian注释，阅读模式下不显示。
+// 更新模式下只重写两个标记之间的内容，其余内容保持不变
+const (
+	regionBegin = "%% MapPhotoMD:begin %%"
+	regionEnd   = "%% MapPhotoMD:end %%"
+)
+
+// existingMarker 旅行记录中已有的标记点
+type existingMarker struct {
+	name   string   //标记点文件名，不含扩展名
+	photo  string   //对应的照片文件名
+	file   string   //正文中引用的照片文件名，转存时为转存后的文件名
+	source string   //照片来源标签
+	index  int      //照片来源的下标，旧版本生成的标记点没有时为-1
+	date   string   //拍摄时间
+	device string   //拍摄设备
+	raw    location //WGS-84坐标，旧版本生成的标记点没有时为零值
+	loc    location //高德坐标
+	place  place    //逆地理编码得到的地点信息
+}
+
+// TripExists 判断导出目录下是否已有同名的旅行记录
+func (t *TravelData) TripExists() bool {
+	_, err := os.Stat(filepath.Join(t.OutputPath, t.TravelName, t.TravelName+".md"))
+	return err == nil
+}
+
+// loadExistingMarkers 读取标记点文件夹中已有的标记点
+func loadExistingMarkers(markerPath string) []existingMarker {
+	var markers []existingMarker
+	entries, _ := os.ReadDir(markerPath)
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".md" {
+			continue
+		}
+		if m, ok := parseMarker(filepath.Join(markerPath, e.Name())); ok {
+			m.name = strings.TrimSuffix(e.Name(), ".md")
+			markers = append(markers, m)
+		}
+	}
+	return markers
+}
+
+// parseMarker 从标记点文件中读取照片文件名、拍摄时间、坐标等属性。
+// 旧版本生成的标记点没有photo属性，此时使用正文中嵌入的照片名
+func parseMarker(path string) (existingMarker, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return existingMarker{}, false
+	}
+	defer file.Close()
+
+	m := existingMarker{index: -1}
+	var hasLoc bool
+	var embed string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		key, value, found := strings.Cut(line, ":")
+		value = strings.TrimSpace(value)
+		switch {
+		case found && key == "photo":
+			m.photo = unquoteYAML(value)
+		case found && key == "source":
+			m.source = unquoteYAML(value)
+		case found && key == "source_index":
+			if index, err := strconv.Atoi(value); err == nil {
+				m.index = index
+			}
+		case found && key == "date":
+			m.date = unquoteYAML(value)
+		case found && key == "device":
+			m.device = unquoteYAML(value)
+		case found && key == "gps":
+			m.raw, _ = parseLocation(value)
+		case found && key == "country":
+			m.place.Country = unquoteYAML(value)
+		case found && key == "province":
+			m.place.Province = unquoteYAML(value)
+		case found && key == "city":
+			m.place.City = unquoteYAML(value)
+		case found && key == "district":
+			m.place.District = unquoteYAML(value)
+		case found && key == "poi":
+			m.place.POI = unquoteYAML(value)
+		case found && key == "location":
+			m.loc, hasLoc = parseLocation(value)
+		case strings.HasPrefix(line, "[[") && strings.HasSuffix(line, "|查看原图]]"):
+			embed = strings.TrimSuffix(strings.TrimPrefix(line, "[["), "|查看原图]]")
+		case strings.HasPrefix(line, "![[") && embed == "":
+			embed = strings.TrimSuffix(strings.TrimPrefix(line, "![["), "]]")
+		}
+	}
+	m.file = embed
+	if m.photo == "" {
+		m.photo = embed
+	}
+	return m, hasLoc && m.photo != ""
+}
+
+// unquoteYAML 去掉yamlValue添加的引号
+func unquoteYAML(s string) string {
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return s
+}
+
+// parseLocation 解析标记点中[纬度,经度]格式的坐标
+func parseLocation(s string) (location, bool) {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	lat, long, found := strings.Cut(s, ",")
+	if !found {
+		return location{}, false
+	}
+	latV, errLat := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	longV, errLong := strconv.ParseFloat(strings.TrimSpace(long), 64)
+	if errLat != nil || errLong != nil {
+		return location{}, false
+	}
+	return location{latV, longV}, true
+}
+
+// skipExistingPhotos 更新模式下，将已有标记点的照片从有效照片中移除，只为新照片生成标记点。
+// 照片按来源下标和相对路径判断是否已有标记点，旧版本生成的标记点没有来源下标，按来源标签和相对路径判断。返回被跳过的照片
+func (t *TravelData) skipExistingPhotos() []string {
+	byIndex := make(map[string]bool)
+	byLabel := make(map[string]bool)
+	for _, m := range pData.existingMarkers {
+		if m.index >= 0 {
+			byIndex[strings.ToLower(strconv.Itoa(m.index)+"|"+m.photo)] = true
+		} else {
+			byLabel[strings.ToLower(m.source+"|"+m.photo)] = true
+		}
+	}
+	var skipped []string
+	keep := make([]bool, len(pData.validPhotos))
+	for i, name := range pData.validPhotos {
+		if byIndex[strings.ToLower(strconv.Itoa(pData.source[i])+"|"+name)] || byLabel[strings.ToLower(t.sourceLabel(i)+"|"+name)] {
+			skipped = append(skipped, name)
+			continue
+		}
+		keep[i] = true
+	}
+	keepPhotos(keep)
+	return skipped
+}
+
+// replaceRegion 将旅行记录中生成的部分替换为region，其余内容保持不变。
+// 没有起止标记时（旧版本生成的旅行记录），替换第一个leaflet代码块；也没有代码块时追加到末尾
+func replaceRegion(note string, region string) string {
+	if begin := strings.Index(note, regionBegin); begin >= 0 {
+		if end := strings.Index(note[begin:], regionEnd); end >= 0 {
+			end += begin + len(regionEnd)
+			return note[:begin] + strings.TrimSuffix(region, "\n") + note[end:]
+		}
+	}
+	if begin := strings.Index(note, "```leaflet\n"); begin >= 0 {
+		if end := strings.Index(note[begin+len("```leaflet\n"):], "```"); end >= 0 {
+			end += begin + len("```leaflet\n") + len("```")
+			return note[:begin] + strings.TrimSuffix(region, "\n") + note[end:]
+		}
+	}
+	if !strings.HasSuffix(note, "\n") {
+		note += "\n"
+	}
+	return note + "\n" + region
+}
+
+// replaceYAMLList 将旅行记录属性中名为name的列表替换为items，没有该属性时添加到属性末尾，其余属性保持不变。
+// items为空时不修改旅行记录
+func replaceYAMLList(note string, name string, items []string) string {
+	if len(items) == 0 {
+		return note
+	}
+	var list strings.Builder
+	writeYAMLList(&list, name, items)
+	if !strings.HasPrefix(note, "---\n") {
+		return "---\n" + list.String() + "---\n\n" + note
+	}
+	end := strings.Index(note[len("---\n"):], "\n---")
+	if end < 0 {
+		return note
+	}
+	end += len("---\n") + 1
+
+	var front strings.Builder
+	lines := strings.SplitAfter(note[len("---\n"):end], "\n")
+	replaced := false
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		key, _, found := strings.Cut(line, ":")
+		if !found || strings.TrimSpace(key) != name || strings.HasPrefix(line, " ") {
+			front.WriteString(line)
+			continue
+		}
+		//跳过原有的列表项
+		for i+1 < len(lines) && strings.HasPrefix(strings.TrimLeft(lines[i+1], " "), "- ") {
+			i++
+		}
+		if !replaced {
+			front.WriteString(list.String())
+			replaced = true
+		}
+	}
+	if !replaced {
+		front.WriteString(list.String())
+	}
+	return "---\n" + front.String() + note[end:]
+}
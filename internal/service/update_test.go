@@ -0,0 +1,335 @@
+package service
+
+import (
+	"MapPhotoMD/internal/config"
+	"MapPhotoMD/internal/model"
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReplaceRegion(t *testing.T) {
+	region := regionBegin + "\n```leaflet\nid: new\n```\n" + regionEnd + "\n"
+	tests := []struct {
+		name string
+		note string
+		want string
+	}{
+		{
+			name: "替换起止标记之间的内容，保留手写的属性和正文",
+			note: "---\ntags: 旅行\n---\n\n" + regionBegin + "\n```leaflet\nid: old\n```\n" + regionEnd + "\n\n手写的游记\n",
+			want: "---\ntags: 旅行\n---\n\n" + region + "\n手写的游记\n",
+		},
+		{
+			name: "旧版本没有起止标记时替换Leaflet代码块",
+			note: "---\ntags: 旅行\n---\n\n```leaflet\nid: old\n```\n手写的游记\n",
+			want: "---\ntags: 旅行\n---\n\n" + region + "手写的游记\n",
+		},
+		{
+			name: "只替换第一个Leaflet代码块",
+			note: "```leaflet\nid: old\n```\n```leaflet\nid: other\n```\n",
+			want: region + "```leaflet\nid: other\n```\n",
+		},
+		{
+			name: "没有Leaflet代码块时追加到末尾",
+			note: "手写的游记",
+			want: "手写的游记\n\n" + region,
+		},
+		{
+			name: "只有开始标记时按没有标记处理",
+			note: regionBegin + "\n手写的游记\n",
+			want: regionBegin + "\n手写的游记\n\n" + region,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replaceRegion(tt.note, region); got != tt.want {
+				t.Errorf("得到\n%q\n应为\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceRegionIdempotent(t *testing.T) {
+	region := regionBegin + "\n```leaflet\nid: new\n```\n" + regionEnd + "\n"
+	note := "---\ntags: 旅行\n---\n\n```leaflet\nid: old\n```\n手写的游记\n"
+	once := replaceRegion(note, region)
+	if twice := replaceRegion(once, region); twice != once {
+		t.Errorf("重复更新后内容发生变化：\n%q\n%q", once, twice)
+	}
+}
+
+func TestParseMarker(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    existingMarker
+		wantOK  bool
+	}{
+		{"有photo属性", "---\nphoto: \"a: b.jpg\"\ndate: 2024-05-01 10:00:00\ndevice: iPhone\ngps: [39.898000,116.294000]\nlocation: [39.900000,116.300000]\nsource: 相机\nsource_index: 1\ncity: 北京市\n---\n![[a_thumb.jpg]]\n[[a.jpg|查看原图]]",
+			existingMarker{photo: "a: b.jpg", file: "a.jpg", source: "相机", index: 1, date: "2024-05-01 10:00:00", device: "iPhone",
+				raw: location{39.898, 116.294}, loc: location{39.9, 116.3}, place: place{City: "北京市"}}, true},
+		{"旧版本使用缩略图下的原图链接", "---\nlocation: [39.9, 116.3]\n---\n![[a_thumb.jpg]]\n[[a.jpg|查看原图]]",
+			existingMarker{photo: "a.jpg", file: "a.jpg", index: -1, loc: location{39.9, 116.3}}, true},
+		{"旧版本使用嵌入的照片", "---\nlocation: [39.9,116.3]\n---\n![[a.jpg]]",
+			existingMarker{photo: "a.jpg", file: "a.jpg", index: -1, loc: location{39.9, 116.3}}, true},
+		{"没有坐标", "---\nphoto: a.jpg\n---\n![[a.jpg]]", existingMarker{photo: "a.jpg", file: "a.jpg", index: -1}, false},
+		{"没有照片", "---\nlocation: [39.9,116.3]\n---\n", existingMarker{index: -1, loc: location{39.9, 116.3}}, false},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "m.md")
+			os.WriteFile(path, []byte(tt.content), 0644)
+			got, ok := parseMarker(path)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("得到%+v %v，应为%+v %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSkipExistingPhotos(t *testing.T) {
+	tests := []struct {
+		name    string
+		inputs  []*model.InputSourceData
+		markers []existingMarker
+		want    []string //被跳过的照片的来源下标和文件名
+	}{
+		{
+			name:    "未设置标签的文件夹中的同名照片按来源下标区分",
+			inputs:  []*model.InputSourceData{{Path: "/a"}, {Path: "/b"}},
+			markers: []existingMarker{{photo: "IMG_0001.jpg", index: 0}, {photo: "other.jpg", index: 1}},
+			want:    []string{"0|IMG_0001.jpg"},
+		},
+		{
+			name:    "忽略大小写",
+			inputs:  []*model.InputSourceData{{Path: "/a"}, {Path: "/b"}},
+			markers: []existingMarker{{photo: "img_0002.JPG", index: 1}},
+			want:    []string{"1|IMG_0002.jpg"},
+		},
+		{
+			name:    "旧版本标记点没有来源下标时按来源标签区分",
+			inputs:  []*model.InputSourceData{{Path: "/a", Label: "手机"}, {Path: "/b", Label: "相机"}},
+			markers: []existingMarker{{photo: "IMG_0001.jpg", source: "相机", index: -1}, {photo: "IMG_0002.jpg", index: -1}},
+			want:    []string{"1|IMG_0001.jpg"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setPhotos([]string{"IMG_0001.jpg", "IMG_0001.jpg", "IMG_0002.jpg"}, []string{"", "", ""})
+			pData.source = []int{0, 1, 1}
+			pData.existingMarkers = tt.markers
+			td := &TravelData{Inputs: tt.inputs}
+			skipped := td.skipExistingPhotos()
+			var want []string
+			for _, w := range tt.want {
+				want = append(want, w[strings.Index(w, "|")+1:])
+			}
+			if !reflect.DeepEqual(skipped, want) {
+				t.Errorf("跳过的照片为%v，应为%v", skipped, want)
+			}
+			//剩余照片的各切片保持一一对应
+			var remain []string
+			for i, name := range pData.validPhotos {
+				remain = append(remain, fmt.Sprintf("%d|%s", pData.source[i], name))
+			}
+			if len(remain)+len(skipped) != 3 || len(pData.rawLocation) != len(remain) {
+				t.Fatalf("剩余的照片为%v", remain)
+			}
+			for _, w := range tt.want {
+				for _, r := range remain {
+					if r == w {
+						t.Errorf("%s应被跳过，剩余的照片为%v", w, remain)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFitZoom(t *testing.T) {
+	tests := []struct {
+		name      string
+		locations []location
+		want      int
+	}{
+		{"只有一个点", []location{{39.9, 116.3}}, defaultZoom},
+		{"同一地点", []location{{39.9, 116.3}, {39.9, 116.3}}, defaultZoom},
+		{"城市内", []location{{39.90, 116.30}, {39.95, 116.40}}, 12},
+		{"跨省", []location{{39.9, 116.3}, {31.2, 121.5}}, 5},
+	}
+	for _, tt := range tests {
+		if got := fitZoom(tt.locations); got != tt.want {
+			t.Errorf("%s：缩放级别为%d，应为%d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// planAndExecute 制定计划并按计划生成旅行记录
+func planAndExecute(t *testing.T, td *TravelData, cfg *config.UserConfig) (*Plan, *Report) {
+	t.Helper()
+	plan, err := td.PlanMD(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := td.Execute(plan, cfg)
+	if len(report.ExportErrors) != 0 {
+		t.Fatalf("导出失败：%v", report.ExportErrors)
+	}
+	return plan, report
+}
+
+func TestUpdateExportsAllPhotos(t *testing.T) {
+	dir := chdirTemp(t)
+	in := filepath.Join(dir, "in")
+	writeJPEG(t, in, "a.jpg", testPhoto{date: "2024:05:01 10:00:00", lat: 39.9, long: 116.3})
+	cfg := config.NewUserConfig()
+	cfg.AmapBaseURL = newConvertServer(t).URL
+	cfg.MovePhoto = false
+	td := &TravelData{TravelName: "trip", Inputs: []*model.InputSourceData{{Path: in}}, OutputPath: filepath.Join(dir, "out"),
+		Exports: []string{Export_GeoJSON, Export_KML, Export_KMZ, Export_GPX, Export_CSV, Export_XLSX}}
+	planAndExecute(t, td, cfg)
+
+	//添加一张新照片后以更新模式生成，导出的文件应同时包含已有标记点和新照片
+	writeJPEG(t, in, "b.jpg", testPhoto{date: "2024:05:01 11:00:00", lat: 39.91, long: 116.31})
+	td.Update = true
+	plan, _ := planAndExecute(t, td, cfg)
+	if !plan.Update || !reflect.DeepEqual(plan.ValidPhotos, []string{"b.jpg"}) {
+		t.Fatalf("更新模式下应只为新照片生成标记点：%+v", plan)
+	}
+	base := filepath.Join(td.OutputPath, "trip")
+
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(readText(filepath.Join(base, "trip.csv")), "\uFEFF"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[1][0] != "b.jpg" || records[2][0] != "a.jpg" || records[2][2] != "已有" {
+		t.Errorf("CSV应有表头和2行数据：%v", records)
+	}
+
+	var fc struct {
+		Features []struct {
+			Geometry struct {
+				Coordinates [2]float64 `json:"coordinates"`
+			} `json:"geometry"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal([]byte(readText(filepath.Join(base, "trip.geojson"))), &fc); err != nil {
+		t.Fatal(err)
+	}
+	//已有标记点使用其中保存的WGS-84坐标
+	if len(fc.Features) != 2 || fc.Features[1].Geometry.Coordinates != [2]float64{116.3, 39.9} {
+		t.Errorf("GeoJSON要素为%+v", fc.Features)
+	}
+
+	var gpx gpxDocument
+	if err := xml.Unmarshal([]byte(readText(filepath.Join(base, "trip.gpx"))), &gpx); err != nil {
+		t.Fatal(err)
+	}
+	if len(gpx.Waypoints) != 2 || gpx.Track == nil || len(gpx.Track.Points) != 2 || gpx.Track.Points[0].Lat != 39.9 {
+		t.Errorf("GPX航点为%+v，轨迹为%+v", gpx.Waypoints, gpx.Track)
+	}
+
+	if n := strings.Count(readText(filepath.Join(base, "trip.kml")), "<Placemark>"); n != 3 {
+		t.Errorf("KML应有2个照片地标和1条路线，共有%d个地标", n)
+	}
+
+	zr, err := zip.OpenReader(filepath.Join(base, "trip.kmz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	if len(zr.File) != 3 {
+		t.Errorf("KMZ应包含doc.kml和2张照片，有%d个文件", len(zr.File))
+	}
+
+	xr, err := zip.OpenReader(filepath.Join(base, "trip.xlsx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer xr.Close()
+	for _, f := range xr.File {
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if n := strings.Count(string(data), "<row "); n != 3 {
+			t.Errorf("XLSX应有表头和2行数据，有%d行", n)
+		}
+	}
+}
+
+func TestUpdateSkipsExistingBeforeConvert(t *testing.T) {
+	dir := chdirTemp(t)
+	in := filepath.Join(dir, "in")
+	writeJPEG(t, in, "a.jpg", testPhoto{date: "2024:05:01 10:00:00", lat: 21.5, long: 101.5})
+	//记录发送给坐标转换接口的坐标
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Query().Get("locations"))
+		fmt.Fprintf(w, `{"status":"1","info":"ok","locations":"%s"}`, r.URL.Query().Get("locations"))
+	}))
+	defer srv.Close()
+	cfg := config.NewUserConfig()
+	cfg.AmapBaseURL = srv.URL
+	cfg.MovePhoto = false
+	cfg.Geocoder = config.Geocoder_Offline
+	cfg.GeoDataPath = writeGeoData(t)
+	td := &TravelData{TravelName: "trip", Inputs: []*model.InputSourceData{{Path: in}}, OutputPath: filepath.Join(dir, "out")}
+	planAndExecute(t, td, cfg)
+
+	writeJPEG(t, in, "b.jpg", testPhoto{date: "2024:05:01 11:00:00", lat: 25.1, long: 105.1})
+	td.Update = true
+	requested = nil
+	plan, _ := planAndExecute(t, td, cfg)
+	if !reflect.DeepEqual(plan.ExistingPhotos, []string{"a.jpg"}) {
+		t.Errorf("跳过的照片为%v", plan.ExistingPhotos)
+	}
+	//已有标记点的照片不再发送给高德
+	if len(requested) != 1 || !strings.HasPrefix(requested[0], "105.1") {
+		t.Errorf("发送给坐标转换接口的坐标为%v，应只有新照片", requested)
+	}
+	//到访城市合并已有标记点和新照片的地点
+	note := readText(filepath.Join(td.OutputPath, "trip", "trip.md"))
+	if !strings.Contains(note, "cities: \n  - 边界市\n  - 城市甲\n") || strings.Count(note, "cities:") != 1 {
+		t.Errorf("旅行记录属性中的到访城市错误：\n%s", note)
+	}
+}
+
+func TestReplaceYAMLList(t *testing.T) {
+	tests := []struct {
+		name  string
+		note  string
+		items []string
+		want  string
+	}{
+		{"替换已有列表", "---\ntags: 旅行\ncities: \n  - 杭州市\nend_date: 2024-05-03\n---\n\n正文\n", []string{"杭州市", "上海市"},
+			"---\ntags: 旅行\ncities: \n  - 杭州市\n  - 上海市\nend_date: 2024-05-03\n---\n\n正文\n"},
+		{"没有列表时添加到属性末尾", "---\ntags: 旅行\n---\n\n正文\n", []string{"上海市"},
+			"---\ntags: 旅行\ncities: \n  - 上海市\n---\n\n正文\n"},
+		{"不修改名称相近的属性", "---\ncities_old: 杭州市\n---\n", []string{"上海市"},
+			"---\ncities_old: 杭州市\ncities: \n  - 上海市\n---\n"},
+		{"列表为空时不修改", "---\ncities: \n  - 杭州市\n---\n", nil, "---\ncities: \n  - 杭州市\n---\n"},
+		{"没有属性时添加属性", "正文\n", []string{"上海市"}, "---\ncities: \n  - 上海市\n---\n\n正文\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replaceYAMLList(tt.note, "cities", tt.items); got != tt.want {
+				t.Errorf("得到\n%q\n应为\n%q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package ui
+
+import (
+	"MapPhotoMD/internal/config"
+	"MapPhotoMD/internal/service"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+// showWait 显示带活动指示器的等待对话框，返回对话框及其中的活动指示器、文本和内容，用于之后显示处理结果
+func showWait(win fyne.Window, msg string) (dialog.Dialog, *widget.Activity, *widget.Label, *fyne.Container) {
+	//活动指示器，显示后台处理状态
+	act := widget.NewActivity()
+
+	//自定义对话框的内容
+	text := widget.NewLabel(msg)
+	content := container.NewVBox(
+		container.NewHBox(
+			layout.NewSpacer(),
+			act,
+			layout.NewSpacer(),
+		),
+		container.NewHBox(
+			layout.NewSpacer(),
+			text,
+			layout.NewSpacer(),
+		),
+	)
+
+	//创建对话框
+	waitDialog := dialog.NewCustom("请等待...", "确定", content, win)
+	waitDialog.Resize(fyne.NewSize(200, 150))
+	waitDialog.Show()
+
+	//启动活动指示器
+	act.Start()
+	return waitDialog, act, text, content
+}
+
+// generate 旅行记录已存在时先询问是否以更新模式生成，再读取照片并制定生成计划
+func generate(win fyne.Window, travelData *service.TravelData, cfg *config.UserConfig) {
+	travelData.Update = false
+	if !travelData.TripExists() {
+		planAndExecute(win, travelData, cfg)
+		return
+	}
+	updateDialog := dialog.NewConfirm("旅行记录已存在",
+		"导出目录下已有同名的旅行记录。\n更新：只为新照片添加标记点，保留旅行记录中手写的内容\n重新生成：覆盖已有的旅行记录和标记点",
+		func(b bool) {
+			travelData.Update = b
+			planAndExecute(win, travelData, cfg)
+		}, win)
+	updateDialog.SetConfirmText("更新")
+	updateDialog.SetDismissText("重新生成")
+	updateDialog.Show()
+}
+
+// planAndExecute 读取照片并制定生成计划，在预览对话框中列出将进行的操作，用户确认后按计划生成并显示结果
+func planAndExecute(win fyne.Window, travelData *service.TravelData, cfg *config.UserConfig) {
+	planDialog, act, _, _ := showWait(win, "读取照片中...")
+	plan, err := travelData.PlanMD(cfg)
+	act.Stop()
+	planDialog.Hide()
+	if err != nil {
+		dialog.ShowError(err, win)
+		return
+	}
+
+	//生成预览，内容较多时可滚动
+	planScroll := container.NewScroll(widget.NewLabel(plan.Summary()))
+	planScroll.SetMinSize(fyne.NewSize(600, 400))
+	reviewDialog := dialog.NewCustomConfirm("生成预览", "继续生成", "取消", planScroll, func(b bool) {
+		//用户选择取消，则不写入任何文件
+		if !b {
+			return
+		}
+		resultDialog, act, text, content := showWait(win, "生成中...")
+
+		//开始处理照片
+		report := travelData.Execute(plan, cfg)
+
+		//停止活动指示器
+		act.Stop()
+
+		//显示处理结果
+		if str := report.Summary(cfg); str != "" {
+			text.Text = str
+			content.Refresh()
+
+			//重新调整对话框大小
+			minSize := content.MinSize()
+			resultDialog.Resize(minSize)
+		} else {
+			text.Text = "生成成功！"
+			content.Refresh()
+		}
+	}, win)
+	reviewDialog.Show()
+}
@@ -14,6 +14,12 @@ func MakeMenu(ap fyne.App, win fyne.Window, cfg *config.UserConfig) *fyne.MainMe
 	helpItem := fyne.NewMenuItem("使用说明", func() {
 		ShowHelp(ap)
 	})
+	undoItem := fyne.NewMenuItem("撤销上次生成", func() {
+		showUndo(win)
+	})
+	restoreItem := fyne.NewMenuItem("恢复上次删除的照片", func() {
+		showRestore(win)
+	})
 	aboutItem := fyne.NewMenuItem("关于", func() {
 		showAbout(ap, win)
 	})
@@ -21,6 +27,8 @@ func MakeMenu(ap fyne.App, win fyne.Window, cfg *config.UserConfig) *fyne.MainMe
 	//添加菜单项到菜单栏
 	options := fyne.NewMenu("选项",
 		settingItem, //设置
+		undoItem,    //撤销上次生成
+		restoreItem, //恢复上次删除的照片
 		helpItem,    //使用说明
 		aboutItem,   //关于
 	)
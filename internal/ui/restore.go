@@ -0,0 +1,59 @@
+package ui
+
+import (
+	"MapPhotoMD/internal/service"
+	"fmt"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+)
+
+// showRestore 确认后将上次生成时删除的原照片移回原位置，并显示恢复结果
+func showRestore(win fyne.Window) {
+	dialog.ShowConfirm("恢复照片", "是否将上次生成时删除的原照片恢复到原位置？", func(b bool) {
+		if !b {
+			return
+		}
+		restored, failed := service.RestoreDeletedPhotos()
+		str := fmt.Sprintf("已恢复%d张照片", restored)
+		if len(failed) != 0 {
+			str = str + "\n以下照片未能恢复：\n"
+			for _, f := range failed {
+				str = str + f + "\n"
+			}
+		}
+		dialog.ShowInformation("恢复照片", str, win)
+	}, win)
+}
+
+// showUndo 显示上次生成的信息，确认后撤销上次生成，并显示撤销结果
+func showUndo(win fyne.Window) {
+	m, err := service.LastGeneration()
+	if err != nil {
+		dialog.ShowError(err, win)
+		return
+	}
+	msg := fmt.Sprintf("旅行记录：%s\n生成时间：%s\n将删除生成的%d个文件或将其还原为生成前的内容", m.BasePath, m.Time, len(m.Files))
+	if len(m.DeletedPhotos) != 0 {
+		msg = msg + fmt.Sprintf("，并恢复删除的%d张原照片", len(m.DeletedPhotos))
+	}
+	dialog.ShowConfirm("撤销上次生成", msg+"\n生成后修改过的文件不会被撤销。是否继续？", func(b bool) {
+		if !b {
+			return
+		}
+		undone, failed, err := service.UndoLastGeneration()
+		if err != nil {
+			dialog.ShowError(err, win)
+			return
+		}
+		str := fmt.Sprintf("已撤销%d个文件", undone)
+		if len(failed) != 0 {
+			str = str + "\n以下文件未能撤销：\n"
+			for _, f := range failed {
+				str = str + f + "\n"
+			}
+			str = str + "已保留本次生成的清单和备份，处理后可以再次撤销"
+		}
+		dialog.ShowInformation("撤销上次生成", str, win)
+	}, win)
+}
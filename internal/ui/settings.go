@@ -2,7 +2,13 @@ package ui
 
 import (
 	"MapPhotoMD/internal/config"
+	"MapPhotoMD/internal/service"
 	"MapPhotoMD/mywidget"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -11,6 +17,144 @@ import (
 	"fyne.io/fyne/v2/widget"
 )
 
+// 逆地理编码方式的显示名称
+var geocoderNames = []string{"关闭", "高德在线", "离线数据集"}
+
+// 逆地理编码方式显示名称与配置值的映射表
+var geocoderName2Value = map[string]string{
+	"关闭":    config.Geocoder_None,
+	"高德在线":  config.Geocoder_Amap,
+	"离线数据集": config.Geocoder_Offline,
+}
+
+// 逆地理编码方式配置值与显示名称的映射表
+var geocoderValue2Name = map[string]string{
+	config.Geocoder_None:    "关闭",
+	config.Geocoder_Amap:    "高德在线",
+	config.Geocoder_Offline: "离线数据集",
+}
+
+// 照片GPS信息处理方式的显示名称
+var photoGPSNames = []string{"保留", "删除", "模糊"}
+
+// 照片GPS信息处理方式显示名称与配置值的映射表
+var photoGPSName2Value = map[string]string{
+	"保留": config.PhotoGPS_Keep,
+	"删除": config.PhotoGPS_Strip,
+	"模糊": config.PhotoGPS_Coarsen,
+}
+
+// 照片GPS信息处理方式配置值与显示名称的映射表
+var photoGPSValue2Name = map[string]string{
+	config.PhotoGPS_Keep:    "保留",
+	config.PhotoGPS_Strip:   "删除",
+	config.PhotoGPS_Coarsen: "模糊",
+}
+
+// 删除原照片方式的显示名称
+var deleteToNames = []string{"移到暂存目录", "移到回收站"}
+
+// 删除原照片方式显示名称与配置值的映射表
+var deleteToName2Value = map[string]string{
+	"移到暂存目录": config.DeleteTo_Folder,
+	"移到回收站":  config.DeleteTo_Trash,
+}
+
+// 删除原照片方式配置值与显示名称的映射表
+var deleteToValue2Name = map[string]string{
+	config.DeleteTo_Folder: "移到暂存目录",
+	config.DeleteTo_Trash:  "移到回收站",
+}
+
+// 坐标模糊精度的显示名称，下标+1为保留的小数位数
+var gpsPrecisionNames = []string{"1位（约11公里）", "2位（约1.1公里）", "3位（约110米）", "4位（约11米）"}
+
+// 读取子文件夹层数的显示名称
+var scanDepthNames = []string{"不限制", "不读取子文件夹", "1层", "2层", "3层"}
+
+// 读取子文件夹层数显示名称与配置值的映射表
+var scanDepthName2Value = map[string]int{
+	"不限制":     -1,
+	"不读取子文件夹": 0,
+	"1层":      1,
+	"2层":      2,
+	"3层":      3,
+}
+
+// 读取子文件夹层数配置值与显示名称的映射表
+var scanDepthValue2Name = map[int]string{
+	-1: "不限制",
+	0:  "不读取子文件夹",
+	1:  "1层",
+	2:  "2层",
+	3:  "3层",
+}
+
+// splitGlobs 将以逗号分隔的包含、排除规则拆分为列表，忽略空规则
+func splitGlobs(text string) []string {
+	var globs []string
+	for _, g := range strings.Split(strings.ReplaceAll(text, "，", ","), ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			globs = append(globs, g)
+		}
+	}
+	return globs
+}
+
+// 照片位于隐私区域内时的处理方式的显示名称
+var geofenceModeNames = []string{"排除照片", "只隐藏标记点"}
+
+// 隐私区域处理方式显示名称与配置值的映射表
+var geofenceModeName2Value = map[string]string{
+	"排除照片":   config.Geofence_Exclude,
+	"只隐藏标记点": config.Geofence_HideMarker,
+}
+
+// 隐私区域处理方式配置值与显示名称的映射表
+var geofenceModeValue2Name = map[string]string{
+	config.Geofence_Exclude:    "排除照片",
+	config.Geofence_HideMarker: "只隐藏标记点",
+}
+
+// formatGeofences 将隐私区域转换为多行文本，每行为 名称,纬度,经度,半径
+func formatGeofences(fences []config.Geofence) string {
+	lines := make([]string, 0, len(fences))
+	for _, f := range fences {
+		lines = append(lines, fmt.Sprintf("%s,%v,%v,%v", f.Name, f.Lat, f.Long, f.Radius))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseGeofences 解析多行文本中的隐私区域，忽略空行，格式错误时返回出错的行号
+func parseGeofences(text string) ([]config.Geofence, error) {
+	var fences []config.Geofence
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(strings.ReplaceAll(line, "，", ","), ",")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("第%d行格式错误", i+1)
+		}
+		//依次解析纬度、经度、半径
+		var nums [3]float64
+		for j := range nums {
+			n, err := strconv.ParseFloat(strings.TrimSpace(fields[j+1]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("第%d行格式错误", i+1)
+			}
+			nums[j] = n
+		}
+		if nums[2] <= 0 {
+			return nil, fmt.Errorf("第%d行半径必须大于0", i+1)
+		}
+		f := config.Geofence{Name: strings.TrimSpace(fields[0]), Lat: nums[0], Long: nums[1], Radius: nums[2]}
+		fences = append(fences, f)
+	}
+	return fences, nil
+}
+
 // showSettings 显示设置
 func showSettings(ap fyne.App, win fyne.Window, config *config.UserConfig) {
 	//读取配置文件
@@ -20,20 +164,70 @@ func showSettings(ap fyne.App, win fyne.Window, config *config.UserConfig) {
 		Key            string
 		NotePath       string
 		SaveIOpath     bool
+		ScanDepth      int
+		SkipHidden     bool
+		IncludeGlobs   string
+		ExcludeGlobs   string
 		MovePhoto      bool
+		MirrorFolders  bool
 		PhotoPath      string
 		DeletePhoto    bool
+		DeleteTo       string
+		DeletedPath    string
 		PhotoQuality   int
+		PhotoMaxEdge   int
+		KeepEXIF       bool
+		RenamePhoto    bool
+		PhotoName      string
+		PhotoGPS       string
+		GPSPrecision   int
+		CoarsenMarkers bool
+		Geofences      string
+		GeofenceMode   string
 		SaveProperties bool
+		MarkerName     string
+		DrawRoute      bool
+		RouteColor     string
+		SplitRouteDay  bool
+		Geocoder       string
+		AmapBaseURL    string
+		GeoDataPath    string
+		MakeThumbnail  bool
+		ThumbnailSize  int
 	}{
 		Key:            config.Key,
 		NotePath:       config.NotePath,
 		SaveIOpath:     config.SaveIOPath,
+		ScanDepth:      config.ScanDepth,
+		SkipHidden:     config.SkipHidden,
+		IncludeGlobs:   strings.Join(config.IncludeGlobs, ","),
+		ExcludeGlobs:   strings.Join(config.ExcludeGlobs, ","),
 		MovePhoto:      config.MovePhoto,
+		MirrorFolders:  config.MirrorFolders,
 		PhotoPath:      config.PhotoPath,
 		DeletePhoto:    config.DeletePhoto,
+		DeleteTo:       config.DeleteTo,
+		DeletedPath:    config.DeletedPath,
 		PhotoQuality:   config.PhotoQuality,
+		PhotoMaxEdge:   config.PhotoMaxEdge,
+		KeepEXIF:       config.KeepEXIF,
+		RenamePhoto:    config.RenamePhoto,
+		PhotoName:      config.PhotoName,
+		PhotoGPS:       config.PhotoGPS,
+		GPSPrecision:   config.GPSPrecision,
+		CoarsenMarkers: config.CoarsenMarkers,
+		Geofences:      formatGeofences(config.Geofences),
+		GeofenceMode:   config.GeofenceMode,
 		SaveProperties: config.SaveProperties,
+		MarkerName:     config.MarkerName,
+		DrawRoute:      config.DrawRoute,
+		RouteColor:     config.RouteColor,
+		SplitRouteDay:  config.SplitRouteDay,
+		Geocoder:       config.Geocoder,
+		AmapBaseURL:    config.AmapBaseURL,
+		GeoDataPath:    config.GeoDataPath,
+		MakeThumbnail:  config.MakeThumbnail,
+		ThumbnailSize:  config.ThumbnailSize,
 	}
 
 	//Key
@@ -67,17 +261,123 @@ func showSettings(ap fyne.App, win fyne.Window, config *config.UserConfig) {
 		saveIOpathRadio.SetSelected("否")
 	}
 
+	//读取子文件夹的层数
+	scanDepthSelect := widget.NewSelect(scanDepthNames, func(s string) {
+		temp.ScanDepth = scanDepthName2Value[s]
+	})
+	scanDepthSelect.SetSelected(scanDepthValue2Name[config.ScanDepth]) //还原设置
+
+	//是否跳过隐藏的文件和文件夹
+	skipHiddenRadio := widget.NewRadioGroup([]string{"是", "否"}, func(s string) {
+		if s == "是" {
+			temp.SkipHidden = true
+		} else {
+			temp.SkipHidden = false
+		}
+	})
+	skipHiddenRadio.Horizontal = true
+	switch config.SkipHidden { //还原设置
+	case true:
+		skipHiddenRadio.SetSelected("是")
+	case false:
+		skipHiddenRadio.SetSelected("否")
+	}
+
+	//只读取匹配的照片
+	includeGlobsEntry := widget.NewEntry()
+	includeGlobsEntry.SetText(temp.IncludeGlobs) //还原设置
+	includeGlobsEntry.SetPlaceHolder("不填为全部读取，多条用逗号分隔，例：IMG_*,DCIM/*")
+	includeGlobsEntry.Validator = func(s string) error { //检查规则格式
+		return service.CheckGlobs(splitGlobs(s))
+	}
+	includeGlobsEntry.OnChanged = func(s string) {
+		temp.IncludeGlobs = s
+	}
+
+	//跳过匹配的照片和文件夹
+	excludeGlobsEntry := widget.NewEntry()
+	excludeGlobsEntry.SetText(temp.ExcludeGlobs) //还原设置
+	excludeGlobsEntry.SetPlaceHolder("多条用逗号分隔，例：Screenshots,*_edited.jpg")
+	excludeGlobsEntry.Validator = func(s string) error { //检查规则格式
+		return service.CheckGlobs(splitGlobs(s))
+	}
+	excludeGlobsEntry.OnChanged = func(s string) {
+		temp.ExcludeGlobs = s
+	}
+
 	//转存路径
 	photoPath := mywidget.NewFolderOpenWithEntry(func(s string) {
 		temp.PhotoPath = s
 	}, "默认为 旅行名称/pictures", win)
 	photoPath.SetEntryText(config.PhotoPath) //还原设置
 
+	//转存照片命名模板
+	photoNameEntry := widget.NewEntry()
+	photoNameEntry.SetText(config.PhotoName) //还原设置
+	photoNameEntry.OnChanged = func(s string) {
+		temp.PhotoName = s
+	}
+	photoNameEntry.SetPlaceHolder("默认为{date}_{time}_{trip}_{seq}，另可用{name}{hash}")
+
+	//转存时是否保留子文件夹结构
+	mirrorFoldersRadio := widget.NewRadioGroup([]string{"是", "否"}, func(s string) {
+		if s == "是" {
+			temp.MirrorFolders = true
+		} else {
+			temp.MirrorFolders = false
+		}
+	})
+	mirrorFoldersRadio.Horizontal = true
+	switch config.MirrorFolders { //还原设置
+	case true:
+		mirrorFoldersRadio.SetSelected("是")
+	case false:
+		mirrorFoldersRadio.SetSelected("否")
+	}
+
+	//是否重命名转存的照片
+	renamePhotoRadio := widget.NewRadioGroup([]string{"是", "否"}, func(s string) {
+		if s == "是" {
+			photoNameEntry.Enable()
+			temp.RenamePhoto = true
+		} else {
+			photoNameEntry.Disable()
+			temp.RenamePhoto = false
+		}
+	})
+	renamePhotoRadio.Horizontal = true
+	switch config.RenamePhoto { //还原设置
+	case true:
+		renamePhotoRadio.SetSelected("是")
+	case false:
+		renamePhotoRadio.SetSelected("否")
+	}
+
+	//原照片暂存目录
+	deletedPath := mywidget.NewFolderOpenWithEntry(func(s string) {
+		temp.DeletedPath = s
+	}, "默认为 配置文件目录/deleted_photos", win)
+	deletedPath.SetEntryText(config.DeletedPath) //还原设置
+
+	//删除原照片的方式
+	deleteToSelect := widget.NewSelect(deleteToNames, func(s string) {
+		//改变暂存目录选择控件的状态，临时保存设置
+		if s == "移到暂存目录" {
+			deletedPath.Enable()
+		} else {
+			deletedPath.Disable()
+		}
+		temp.DeleteTo = deleteToName2Value[s]
+	})
+	deleteToSelect.SetSelected(deleteToValue2Name[config.DeleteTo]) //还原设置
+
 	//是否删除原照片
 	deletePhotoRadio := widget.NewRadioGroup([]string{"是", "否"}, func(s string) {
 		if s == "是" { //自动保存
+			deleteToSelect.Enable()
 			temp.DeletePhoto = true
 		} else {
+			deleteToSelect.Disable()
 			temp.DeletePhoto = false
 		}
 	})
@@ -95,10 +395,14 @@ func showSettings(ap fyne.App, win fyne.Window, config *config.UserConfig) {
 		if s == "是" {
 			photoPath.Enable()
 			deletePhotoRadio.Enable()
+			renamePhotoRadio.Enable()
+			mirrorFoldersRadio.Enable()
 			temp.MovePhoto = true
 		} else {
 			photoPath.Disable()
 			deletePhotoRadio.Disable()
+			renamePhotoRadio.Disable()
+			mirrorFoldersRadio.Disable()
 			temp.MovePhoto = false
 		}
 	})
@@ -124,6 +428,35 @@ func showSettings(ap fyne.App, win fyne.Window, config *config.UserConfig) {
 		photoQSlide, photoQLabel,
 	)
 
+	//照片转存后的预计大小，随照片质量和最大长边变化
+	photoSizeLabel := widget.NewLabel("")
+	updatePhotoSize := func() {
+		size := service.EstimatePhotoSize(temp.PhotoQuality, temp.PhotoMaxEdge)
+		if size == 0 {
+			photoSizeLabel.SetText("与原照片相同")
+		} else {
+			photoSizeLabel.SetText(fmt.Sprintf("约 %.1f MB/张（按1200万像素照片估算）", float64(size)/1024/1024))
+		}
+	}
+	photoQData.AddListener(binding.NewDataListener(updatePhotoSize))
+
+	//照片最大长边，0为不限制
+	photoMaxEdgeEntry := widget.NewEntry()
+	if config.PhotoMaxEdge > 0 { //还原设置
+		photoMaxEdgeEntry.SetText(strconv.Itoa(config.PhotoMaxEdge))
+	}
+	photoMaxEdgeEntry.SetPlaceHolder("不填为不限制，例：2048")
+	photoMaxEdgeEntry.Validator = func(s string) error { //检查是否为空或数字
+		if regexp.MustCompile("^\\d*$").MatchString(s) {
+			return nil
+		}
+		return errors.New("")
+	}
+	photoMaxEdgeEntry.OnChanged = func(s string) {
+		temp.PhotoMaxEdge, _ = strconv.Atoi(s)
+		updatePhotoSize()
+	}
+
 	//是否保存属性
 	savePropertiesRadio := widget.NewRadioGroup([]string{"是", "否"}, func(s string) {
 		if s == "是" {
@@ -140,18 +473,243 @@ func showSettings(ap fyne.App, win fyne.Window, config *config.UserConfig) {
 		savePropertiesRadio.SetSelected("否")
 	}
 
-	items := []*widget.FormItem{
+	//标记点命名模板
+	markerNameEntry := widget.NewEntry()
+	markerNameEntry.SetText(config.MarkerName) //还原设置
+	markerNameEntry.OnChanged = func(s string) {
+		temp.MarkerName = s
+	}
+	markerNameEntry.SetPlaceHolder("默认为{name}，可用{name}{date}{time}{hash}")
+
+	//路线颜色
+	routeColorEntry := widget.NewEntry()
+	routeColorEntry.SetText(config.RouteColor) //还原设置
+	routeColorEntry.OnChanged = func(s string) {
+		temp.RouteColor = s
+	}
+	routeColorEntry.SetPlaceHolder("例：#3388ff")
+	routeColorEntry.Validator = func(s string) error { //检查是否是合法的颜色
+		if regexp.MustCompile("^#[0-9a-fA-F]{6}$").MatchString(s) {
+			return nil
+		}
+		return errors.New("")
+	}
+
+	//是否按天拆分路线
+	splitRouteDayRadio := widget.NewRadioGroup([]string{"是", "否"}, func(s string) {
+		if s == "是" {
+			temp.SplitRouteDay = true
+		} else {
+			temp.SplitRouteDay = false
+		}
+	})
+	splitRouteDayRadio.Horizontal = true
+	switch config.SplitRouteDay { //还原设置
+	case true:
+		splitRouteDayRadio.SetSelected("是")
+	case false:
+		splitRouteDayRadio.SetSelected("否")
+	}
+
+	//是否生成旅行路线
+	drawRouteRadio := widget.NewRadioGroup([]string{"是", "否"}, func(s string) {
+		//改变路线相关控件的状态，临时保存设置
+		if s == "是" {
+			routeColorEntry.Enable()
+			splitRouteDayRadio.Enable()
+			temp.DrawRoute = true
+		} else {
+			routeColorEntry.Disable()
+			splitRouteDayRadio.Disable()
+			temp.DrawRoute = false
+		}
+	})
+	drawRouteRadio.Horizontal = true
+	switch config.DrawRoute { //还原设置
+	case true:
+		drawRouteRadio.SetSelected("是")
+	case false:
+		drawRouteRadio.SetSelected("是")
+		//同转存设置，先enable再disable
+		defer drawRouteRadio.SetSelected("否")
+	}
+
+	//高德接口地址
+	amapBaseURLEntry := widget.NewEntry()
+	amapBaseURLEntry.SetText(config.AmapBaseURL) //还原设置
+	amapBaseURLEntry.OnChanged = func(s string) {
+		temp.AmapBaseURL = s
+	}
+	amapBaseURLEntry.SetPlaceHolder("默认为高德官方地址，可改为本地测试服务")
+
+	//离线数据集路径
+	geoDataPath := mywidget.NewFolderOpenWithEntry(func(s string) {
+		temp.GeoDataPath = s
+	}, "默认为 配置文件目录/geodata", win)
+	geoDataPath.SetEntryText(config.GeoDataPath) //还原设置
+
+	//逆地理编码方式
+	geocoderSelect := widget.NewSelect(geocoderNames, func(s string) {
+		//改变离线数据集路径选择控件的状态，临时保存设置
+		if s == "离线数据集" {
+			geoDataPath.Enable()
+		} else {
+			geoDataPath.Disable()
+		}
+		temp.Geocoder = geocoderName2Value[s]
+	})
+	geocoderSelect.SetSelected(geocoderValue2Name[config.Geocoder]) //还原设置
+
+	//缩略图最大长边像素，64~1024
+	thumbSizeData := binding.BindInt(&temp.ThumbnailSize)
+	thumbSizeLabel := widget.NewLabelWithData(binding.IntToStringWithFormat(thumbSizeData, "%d px"))
+	thumbSizeSlide := widget.NewSliderWithData(64, 1024, binding.IntToFloat(thumbSizeData))
+	thumbSizeSlide.Step = 32
+	thumbSizeContent := container.NewAdaptiveGrid(2,
+		thumbSizeSlide, thumbSizeLabel,
+	)
+
+	//压缩照片时是否保留EXIF
+	keepEXIFRadio := widget.NewRadioGroup([]string{"是", "否"}, func(s string) {
+		if s == "是" {
+			temp.KeepEXIF = true
+		} else {
+			temp.KeepEXIF = false
+		}
+	})
+	keepEXIFRadio.Horizontal = true
+	switch config.KeepEXIF { //还原设置
+	case true:
+		keepEXIFRadio.SetSelected("是")
+	case false:
+		keepEXIFRadio.SetSelected("否")
+	}
+
+	//是否生成缩略图
+	makeThumbnailRadio := widget.NewRadioGroup([]string{"是", "否"}, func(s string) {
+		if s == "是" {
+			thumbSizeSlide.Enable()
+			temp.MakeThumbnail = true
+		} else {
+			thumbSizeSlide.Disable()
+			temp.MakeThumbnail = false
+		}
+	})
+	makeThumbnailRadio.Horizontal = true
+	switch config.MakeThumbnail { //还原设置
+	case true:
+		makeThumbnailRadio.SetSelected("是")
+	case false:
+		makeThumbnailRadio.SetSelected("否")
+	}
+
+	//坐标模糊精度
+	gpsPrecisionSelect := widget.NewSelect(gpsPrecisionNames, func(s string) {
+		for i, name := range gpsPrecisionNames {
+			if name == s {
+				temp.GPSPrecision = i + 1
+			}
+		}
+	})
+	if config.GPSPrecision >= 1 && config.GPSPrecision <= len(gpsPrecisionNames) { //还原设置
+		gpsPrecisionSelect.SetSelected(gpsPrecisionNames[config.GPSPrecision-1])
+	}
+
+	//转存照片中GPS信息的处理方式
+	photoGPSSelect := widget.NewSelect(photoGPSNames, func(s string) {
+		temp.PhotoGPS = photoGPSName2Value[s]
+	})
+	photoGPSSelect.SetSelected(photoGPSValue2Name[config.PhotoGPS]) //还原设置
+
+	//是否模糊标记点、路线、地图中心和额外导出中的坐标
+	coarsenMarkersRadio := widget.NewRadioGroup([]string{"是", "否"}, func(s string) {
+		if s == "是" {
+			temp.CoarsenMarkers = true
+		} else {
+			temp.CoarsenMarkers = false
+		}
+	})
+	coarsenMarkersRadio.Horizontal = true
+	switch config.CoarsenMarkers { //还原设置
+	case true:
+		coarsenMarkersRadio.SetSelected("是")
+	case false:
+		coarsenMarkersRadio.SetSelected("否")
+	}
+
+	//隐私区域，每行一个
+	geofencesEntry := widget.NewMultiLineEntry()
+	geofencesEntry.SetText(temp.Geofences) //还原设置
+	geofencesEntry.SetPlaceHolder("每行一个：名称,纬度,经度,半径（米）\n坐标为高德坐标，例：家,39.9087,116.3975,500")
+	geofencesEntry.SetMinRowsVisible(4)
+	geofencesEntry.Validator = func(s string) error { //检查格式是否正确
+		_, err := parseGeofences(s)
+		return err
+	}
+	geofencesEntry.OnChanged = func(s string) {
+		temp.Geofences = s
+	}
+
+	//照片位于隐私区域内时的处理方式
+	geofenceModeSelect := widget.NewSelect(geofenceModeNames, func(s string) {
+		temp.GeofenceMode = geofenceModeName2Value[s]
+	})
+	geofenceModeSelect.SetSelected(geofenceModeValue2Name[config.GeofenceMode]) //还原设置
+
+	//设置项按类别分为多个选项卡
+	generalForm := widget.NewForm(
 		widget.NewFormItem("高德Key", gdKeyEntry),
 		widget.NewFormItem("Ob库路径", notePathEntry),
 		widget.NewFormItem("是否保存导入导出设置", saveIOpathRadio),
+		widget.NewFormItem("是否保存属性", savePropertiesRadio),
+		widget.NewFormItem("标记点命名", markerNameEntry),
+	)
+	photoForm := widget.NewForm(
 		widget.NewFormItem("是否转存照片", movePhotoRadio),
 		widget.NewFormItem("照片转存路径", photoPath),
 		widget.NewFormItem("是否删除原照片", deletePhotoRadio),
+		widget.NewFormItem("删除方式", deleteToSelect),
+		widget.NewFormItem("暂存目录", deletedPath),
+		widget.NewFormItem("保留子文件夹结构", mirrorFoldersRadio),
+		widget.NewFormItem("是否重命名照片", renamePhotoRadio),
+		widget.NewFormItem("照片命名", photoNameEntry),
 		widget.NewFormItem("照片质量", photoQualityContent),
-		widget.NewFormItem("是否保存属性", savePropertiesRadio),
-	}
+		widget.NewFormItem("照片最大长边", photoMaxEdgeEntry),
+		widget.NewFormItem("预计大小", photoSizeLabel),
+		widget.NewFormItem("压缩时保留EXIF", keepEXIFRadio),
+		widget.NewFormItem("是否生成缩略图", makeThumbnailRadio),
+		widget.NewFormItem("缩略图尺寸", thumbSizeContent),
+	)
+	importForm := widget.NewForm(
+		widget.NewFormItem("读取子文件夹", scanDepthSelect),
+		widget.NewFormItem("跳过隐藏的文件", skipHiddenRadio),
+		widget.NewFormItem("只读取", includeGlobsEntry),
+		widget.NewFormItem("跳过", excludeGlobsEntry),
+	)
+	mapForm := widget.NewForm(
+		widget.NewFormItem("是否生成路线", drawRouteRadio),
+		widget.NewFormItem("路线颜色", routeColorEntry),
+		widget.NewFormItem("是否按天拆分路线", splitRouteDayRadio),
+		widget.NewFormItem("逆地理编码", geocoderSelect),
+		widget.NewFormItem("高德接口地址", amapBaseURLEntry),
+		widget.NewFormItem("离线数据集", geoDataPath),
+	)
+	privacyForm := widget.NewForm(
+		widget.NewFormItem("转存照片的GPS信息", photoGPSSelect),
+		widget.NewFormItem("模糊标记点、路线和导出坐标", coarsenMarkersRadio),
+		widget.NewFormItem("模糊精度", gpsPrecisionSelect),
+		widget.NewFormItem("隐私区域", geofencesEntry),
+		widget.NewFormItem("区域内的照片", geofenceModeSelect),
+	)
+	settingTabs := container.NewAppTabs(
+		container.NewTabItem("常规", generalForm),
+		container.NewTabItem("导入", importForm),
+		container.NewTabItem("照片", photoForm),
+		container.NewTabItem("地图", mapForm),
+		container.NewTabItem("隐私", privacyForm),
+	)
 
-	settingDialog := dialog.NewForm("设置", "保存", "取消", items, func(b bool) {
+	settingDialog := dialog.NewCustomConfirm("设置", "保存", "取消", settingTabs, func(b bool) {
 		//用户选择取消，则直接返回
 		if !b {
 			return
@@ -164,15 +722,66 @@ func showSettings(ap fyne.App, win fyne.Window, config *config.UserConfig) {
 			})
 			temp.PhotoPath = ""
 		}
+		//检查路线颜色是否设置正确
+		if temp.DrawRoute && routeColorEntry.Validate() != nil {
+			ap.SendNotification(&fyne.Notification{
+				Title:   "错误",
+				Content: "路线颜色格式错误，已还原为默认颜色",
+			})
+			temp.RouteColor = "#3388ff"
+		}
+		//检查隐私区域是否设置正确，错误时保留原设置
+		fences, err := parseGeofences(temp.Geofences)
+		if err != nil {
+			ap.SendNotification(&fyne.Notification{
+				Title:   "错误",
+				Content: "隐私区域" + err.Error() + "，已保留原设置",
+			})
+			fences = config.Geofences
+		}
+		//检查包含、排除规则是否设置正确，错误时保留原设置
+		includeGlobs, excludeGlobs := splitGlobs(temp.IncludeGlobs), splitGlobs(temp.ExcludeGlobs)
+		if err := service.CheckGlobs(append(append([]string(nil), includeGlobs...), excludeGlobs...)); err != nil {
+			ap.SendNotification(&fyne.Notification{
+				Title:   "错误",
+				Content: "导入" + err.Error() + "，已保留原设置",
+			})
+			includeGlobs, excludeGlobs = config.IncludeGlobs, config.ExcludeGlobs
+		}
 		//保存设置到config.json
 		config.Key = temp.Key
 		config.NotePath = temp.NotePath
 		config.SaveIOPath = temp.SaveIOpath
+		config.ScanDepth = temp.ScanDepth
+		config.SkipHidden = temp.SkipHidden
+		config.IncludeGlobs = includeGlobs
+		config.ExcludeGlobs = excludeGlobs
 		config.MovePhoto = temp.MovePhoto
+		config.MirrorFolders = temp.MirrorFolders
 		config.PhotoPath = temp.PhotoPath
 		config.DeletePhoto = temp.DeletePhoto
+		config.DeleteTo = temp.DeleteTo
+		config.DeletedPath = temp.DeletedPath
 		config.SaveProperties = temp.SaveProperties
 		config.PhotoQuality = temp.PhotoQuality
+		config.PhotoMaxEdge = temp.PhotoMaxEdge
+		config.KeepEXIF = temp.KeepEXIF
+		config.RenamePhoto = temp.RenamePhoto
+		config.PhotoName = temp.PhotoName
+		config.PhotoGPS = temp.PhotoGPS
+		config.GPSPrecision = temp.GPSPrecision
+		config.CoarsenMarkers = temp.CoarsenMarkers
+		config.Geofences = fences
+		config.GeofenceMode = temp.GeofenceMode
+		config.MarkerName = temp.MarkerName
+		config.DrawRoute = temp.DrawRoute
+		config.RouteColor = temp.RouteColor
+		config.SplitRouteDay = temp.SplitRouteDay
+		config.Geocoder = temp.Geocoder
+		config.AmapBaseURL = temp.AmapBaseURL
+		config.GeoDataPath = temp.GeoDataPath
+		config.MakeThumbnail = temp.MakeThumbnail
+		config.ThumbnailSize = temp.ThumbnailSize
 		config.SaveConfigFile(ap)
 
 	}, win)
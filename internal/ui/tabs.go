@@ -2,6 +2,7 @@ package ui
 
 import (
 	"MapPhotoMD/internal/config"
+	"MapPhotoMD/internal/model"
 	"MapPhotoMD/internal/service"
 	"MapPhotoMD/mywidget"
 	"errors"
@@ -26,12 +27,35 @@ var (
 
 // 前两个选项的输入框指针，用于最后检查输入是否合法
 var (
-	travelName *widget.Entry
-	travelDate *widget.Entry
-	inputPath  *mywidget.FolderOpenWithEntry
-	outputPath *mywidget.FolderOpenWithEntry
+	travelName    *widget.Entry
+	travelDate    *widget.Entry
+	travelEndDate *widget.Entry
+	inputSources  []*mywidget.InputSource
+	outputPath    *mywidget.FolderOpenWithEntry
 )
 
+// proWidgets 所有属性控件的指针
+var proWidgets []*mywidget.Property
+
+// validInputSources 检查所有照片来源是否合法
+func validInputSources() bool {
+	for _, src := range inputSources {
+		if !src.GetValid() {
+			return false
+		}
+	}
+	return len(inputSources) > 0
+}
+
+// inputSourcesData 获取所有照片来源控件的数据
+func inputSourcesData() []*model.InputSourceData {
+	var data []*model.InputSourceData
+	for _, src := range inputSources {
+		data = append(data, src.GetInputSourceData())
+	}
+	return data
+}
+
 // makeTabs 创建选项卡组
 func MakeTabs(ap fyne.App, win fyne.Window, cfg *config.UserConfig) *container.AppTabs {
 	travelData = service.NewTravelData()
@@ -84,15 +108,42 @@ func makeTravelTabContent(win fyne.Window) *fyne.Container {
 		return errors.New("")
 	}
 
-	//日历，点击日期时将日期赋值给输入框
+	//旅行结束日期文本框，可为空
+	travelEndDate = widget.NewEntry()
+	travelEndDate.OnChanged = func(s string) {
+		travelData.TravelEndDate = s
+	}
+	travelEndDate.SetPlaceHolder("可不填，再次点击日历选择最后一天，只导入旅行期间拍摄的照片")
+	travelEndDate.Validator = func(s string) error { //检查是否为空或不早于开始日期的合法日期
+		if s == "" {
+			return nil
+		}
+		end, err := time.Parse("2006-01-02", s)
+		if !regexp.MustCompile("^\\d{4}-\\d{2}-\\d{2}$").MatchString(s) || err != nil {
+			return errors.New("")
+		}
+		if start, err := time.Parse("2006-01-02", travelDate.Text); err == nil && end.Before(start) {
+			return errors.New("")
+		}
+		return nil
+	}
+
+	//日历，依次点击开始和结束日期，将日期赋值给输入框。
+	//已选好结束日期，或点击的日期早于开始日期时，重新选择开始日期
 	datePicker := xWidget.NewCalendar(time.Now(), func(t time.Time) {
-		travelDate.SetText(t.Format("2006-01-02"))
+		start, err := time.Parse("2006-01-02", travelDate.Text)
+		if err != nil || travelEndDate.Text != "" || t.Before(start) {
+			travelDate.SetText(t.Format("2006-01-02"))
+			travelEndDate.SetText("")
+			return
+		}
+		travelEndDate.SetText(t.Format("2006-01-02"))
 	})
 
 	//点击跳转下一个选项卡
 	travelNextButton := widget.NewButton("下一步", func() {
 		//检查输入合法性，合法则跳转，否则不跳转并提示
-		if travelDate.Validate() == nil && travelName.Validate() == nil {
+		if travelDate.Validate() == nil && travelEndDate.Validate() == nil && travelName.Validate() == nil {
 			tabs.Select(IOputTab)
 		} else {
 			dialog.ShowError(errors.New("旅行信息未填写或格式错误"), win)
@@ -104,6 +155,7 @@ func makeTravelTabContent(win fyne.Window) *fyne.Container {
 		widget.NewForm(
 			widget.NewFormItem("旅行名称", travelName),
 			widget.NewFormItem("旅行日期", travelDate),
+			widget.NewFormItem("结束日期", travelEndDate),
 			widget.NewFormItem("", datePicker)),
 		//保持跳转按钮靠下
 		layout.NewSpacer(),
@@ -118,11 +170,33 @@ func makeTravelTabContent(win fyne.Window) *fyne.Container {
 
 // makeIOputTabContent 创建导入导出选项卡的内容
 func makeIOputTabContent(win fyne.Window, cfg *config.UserConfig) *fyne.Container {
-	//导入路径文本框
-	inputPath = mywidget.NewFolderOpenWithEntry(func(s string) {
-		travelData.InputPath = s
-	}, "", win)
-	inputPath.SetEntryText(cfg.IOPath.InputPath)
+	//照片来源，每个来源为一个文件夹，可设置标签和相机时钟偏差，所有来源的照片合并到同一旅行记录
+	sourceContainer := container.NewVBox()
+	addSource := func(data model.InputSourceData) {
+		inputSources = append(inputSources, mywidget.NewInputSource(data, win))
+		sourceContainer.Add(inputSources[len(inputSources)-1])
+	}
+	//还原保存的照片来源，没有时添加一个空的来源
+	for _, src := range cfg.IOPath.Inputs {
+		addSource(*src)
+	}
+	if len(inputSources) == 0 {
+		addSource(model.InputSourceData{})
+	}
+
+	//点击添加一个照片来源
+	addSourceButton := widget.NewButton("添加文件夹", func() {
+		addSource(model.InputSourceData{})
+	})
+
+	//点击删除最后一个照片来源，至少保留一个
+	deleteSourceButton := widget.NewButton("删除文件夹", func() {
+		length := len(inputSources)
+		if length > 1 {
+			sourceContainer.Remove(inputSources[length-1])
+			inputSources = inputSources[:length-1]
+		}
+	})
 
 	//导出路径文本框
 	outputPath = mywidget.NewFolderOpenWithEntry(func(s string) {
@@ -130,12 +204,19 @@ func makeIOputTabContent(win fyne.Window, cfg *config.UserConfig) *fyne.Containe
 	}, "", win)
 	outputPath.SetEntryText(cfg.IOPath.OutputPath)
 
+	//额外导出格式，与MD文件一起导出到旅行记录文件夹
+	exportsCheck := widget.NewCheckGroup(service.ExportFormats, func(s []string) {
+		travelData.Exports = s
+	})
+	exportsCheck.Horizontal = true
+	exportsCheck.SetSelected(cfg.IOPath.Exports)
+
 	//点击跳转下一个选项卡
 	IOputNextButton := widget.NewButton("下一步", func() {
-		if inputPath.GetValid() && outputPath.GetValid() {
+		if validInputSources() && outputPath.GetValid() {
 			tabs.Select(propertiesTab)
 		} else {
-			dialog.ShowError(errors.New("导入导出路径不存在或未填写"), win)
+			dialog.ShowError(errors.New("导入导出路径不存在或未填写，或时钟偏差格式错误"), win)
 		}
 	})
 	IOputNextButton.Importance = widget.HighImportance
@@ -147,8 +228,12 @@ func makeIOputTabContent(win fyne.Window, cfg *config.UserConfig) *fyne.Containe
 
 	return container.NewVBox(
 		widget.NewForm(
-			widget.NewFormItem("导入照片", inputPath),
-			widget.NewFormItem("导出到Ob库", outputPath)),
+			widget.NewFormItem("导入照片", container.NewVBox(
+				sourceContainer,
+				container.NewHBox(deleteSourceButton, addSourceButton),
+			)),
+			widget.NewFormItem("导出到Ob库", outputPath),
+			widget.NewFormItem("额外导出", exportsCheck)),
 		//保持按钮靠下
 		layout.NewSpacer(),
 		//保持按钮居中
@@ -164,46 +249,42 @@ func makeIOputTabContent(win fyne.Window, cfg *config.UserConfig) *fyne.Containe
 // makePropertiesTabContent 创建属性设置选项卡的内容
 func makePropertiesTabContent(ap fyne.App, win fyne.Window, cfg *config.UserConfig) *fyne.Container {
 	//属性控件可选的属性类型
-	types := []string{
-		mywidget.ProType_Tag,
-		mywidget.ProType_Aliases,
-		mywidget.ProType_css,
-		mywidget.ProType_Text,
-		mywidget.ProType_List,
-		mywidget.ProType_Num,
-		mywidget.ProType_Check,
-		mywidget.ProType_Date,
-	}
+	types := model.ProTypes
 
 	//所有属性控件纵向排列
 	proContainer := container.NewVBox()
 
 	//还原保存的属性设置
 	for _, pro := range cfg.Properties {
-		travelData.ProIndex = append(travelData.ProIndex, mywidget.NewProperty(types, pro.Type, pro.Name, pro.Value))
-		proContainer.Add(travelData.ProIndex[len(travelData.ProIndex)-1])
+		proWidgets = append(proWidgets, mywidget.NewProperty(types, pro.Type, pro.Name, pro.Value))
+		proContainer.Add(proWidgets[len(proWidgets)-1])
 	}
 
 	//点击开始生成旅行记录文件及文件夹
 	proNextButton := widget.NewButton("开始生成", func() {
 		//检查前两个选项卡输入是否合法
-		if travelName.Validate() != nil || travelDate.Validate() != nil || !inputPath.GetValid() || !outputPath.GetValid() {
+		if travelName.Validate() != nil || travelDate.Validate() != nil || travelEndDate.Validate() != nil || !validInputSources() || !outputPath.GetValid() {
 			dialog.ShowError(errors.New("旅行信息、导入导出设置错误或未填写"), win)
 			return
 		}
 		//检查填写的属性是否正确
-		for _, pIndex := range travelData.ProIndex {
+		for _, pIndex := range proWidgets {
 			if !pIndex.GetValid() {
 				dialog.ShowError(errors.New("属性格式错误，无法进行下一步"), win)
 				return
 			}
 		}
+		//读取照片来源和属性
+		travelData.Inputs = inputSourcesData()
+		travelData.Properties = travelData.Properties[:0]
+		for _, pIndex := range proWidgets {
+			travelData.Properties = append(travelData.Properties, pIndex.GetPropertyData())
+		}
 		//清空之前保存的属性
 		cfg.Properties = cfg.Properties[:0]
 		//按照用户设置，选择是否保存属性
 		if cfg.SaveProperties {
-			for _, pIndex := range travelData.ProIndex {
-				proData := pIndex.GetPropertyData()
+			for _, proData := range travelData.Properties {
 				if proData.Name != "" { //未指定属性名称的不保存
 					cfg.Properties = append(cfg.Properties, proData)
 				}
@@ -211,64 +292,19 @@ func makePropertiesTabContent(ap fyne.App, win fyne.Window, cfg *config.UserConf
 		}
 		//按照用户设置，选择是否保存导入导出路径
 		if cfg.SaveIOPath {
-			cfg.IOPath.InputPath = inputPath.GetEntryText()
+			cfg.IOPath.Inputs = travelData.Inputs
 			cfg.IOPath.OutputPath = outputPath.GetEntryText()
+			cfg.IOPath.Exports = travelData.Exports
 		} else {
-			cfg.IOPath.InputPath = ""
+			cfg.IOPath.Inputs = nil
 			cfg.IOPath.OutputPath = ""
+			cfg.IOPath.Exports = nil
 		}
 		//保存用户配置
 		cfg.SaveConfigFile(ap)
 
-		//活动指示器，显示后台处理状态
-		act := widget.NewActivity()
-
-		//自定义对话框的内容
-		text := widget.NewLabel("生成中...")
-		content := container.NewVBox(
-			container.NewHBox(
-				layout.NewSpacer(),
-				act,
-				layout.NewSpacer(),
-			),
-			container.NewHBox(
-				layout.NewSpacer(),
-				text,
-				layout.NewSpacer(),
-			),
-		)
-
-		//创建对话框
-		resultDialog := dialog.NewCustom("请等待...", "确定", content, win)
-		resultDialog.Resize(fyne.NewSize(200, 150))
-		resultDialog.Show()
-
-		//启动活动指示器
-		act.Start()
-
-		//开始处理照片
-		invalidPhotos := travelData.GenerateMD(cfg)
-
-		//停止活动指示器
-		act.Stop()
-
-		//显示处理结果
-		if len(invalidPhotos) != 0 {
-			//显示无法转换的照片
-			str := "无法转换的照片如下，请检查其是否存在经纬度信息：\n"
-			for _, p := range invalidPhotos {
-				str = str + p + "\n"
-			}
-			text.Text = str
-			content.Refresh()
-
-			//重新调整对话框大小
-			minSize := content.MinSize()
-			resultDialog.Resize(minSize)
-		} else {
-			text.Text = "生成成功！"
-			content.Refresh()
-		}
+		//制定生成计划，预览确认后再生成
+		generate(win, travelData, cfg)
 	})
 	proNextButton.Importance = widget.DangerImportance
 
@@ -279,17 +315,17 @@ func makePropertiesTabContent(ap fyne.App, win fyne.Window, cfg *config.UserConf
 
 	//点击添加一条属性
 	addProButton := widget.NewButton("添加属性", func() {
-		travelData.ProIndex = append(travelData.ProIndex, mywidget.NewProperty(types, "文本", "", ""))
-		proContainer.Add(travelData.ProIndex[len(travelData.ProIndex)-1])
+		proWidgets = append(proWidgets, mywidget.NewProperty(types, "文本", "", ""))
+		proContainer.Add(proWidgets[len(proWidgets)-1])
 	})
 	addProButton.Importance = widget.HighImportance
 
 	//点击删除一条属性，少于一条时无效
 	deleteProButton := widget.NewButton("删除属性", func() {
-		length := len(travelData.ProIndex)
+		length := len(proWidgets)
 		if length > 0 {
-			proContainer.Remove(travelData.ProIndex[length-1])
-			travelData.ProIndex = travelData.ProIndex[:length-1]
+			proContainer.Remove(proWidgets[length-1])
+			proWidgets = proWidgets[:length-1]
 		}
 	})
 
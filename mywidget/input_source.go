@@ -0,0 +1,102 @@
+package mywidget
+
+import (
+	"MapPhotoMD/internal/model"
+	"errors"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+type InputSource struct {
+	widget.BaseWidget
+	SourceContainer *fyne.Container
+	Folder          *FolderOpenWithEntry //照片文件夹
+	Label           *widget.Entry        //来源标签文本框
+	ClockOffset     *widget.Entry        //相机时钟偏差文本框
+}
+
+type InputSourceLayout struct{}
+
+func (lo *InputSourceLayout) MinSize(objects []fyne.CanvasObject) fyne.Size {
+	minSize := fyne.NewSize(0, 0)
+	for _, obj := range objects {
+		minSize = minSize.Max(obj.MinSize())
+	}
+	return minSize
+}
+
+// Layout 文件夹、标签、时钟偏差控件依次水平放置。标签和时钟偏差固定宽度，文件夹占用剩余宽度
+func (lo *InputSourceLayout) Layout(objects []fyne.CanvasObject, containerSize fyne.Size) {
+	if len(objects) != 3 {
+		return
+	}
+	folder := objects[0]
+	label := objects[1]
+	offset := objects[2]
+
+	folder.Resize(fyne.NewSize(containerSize.Width-250, folder.MinSize().Height))
+	folder.Move(fyne.NewPos(0, 0))
+
+	label.Resize(fyne.NewSize(115, label.MinSize().Height))
+	label.Move(fyne.NewPos(containerSize.Width-240, 0))
+
+	offset.Resize(fyne.NewSize(115, offset.MinSize().Height))
+	offset.Move(fyne.NewPos(containerSize.Width-115, 0))
+}
+
+// validator_offset 时钟偏差检查器。文本不为空且不是合法的时长（如 -1h、+8h30m）时返回error
+func validator_offset(s string) error {
+	if s == "" {
+		return nil
+	}
+	if _, err := time.ParseDuration(s); err != nil {
+		return errors.New("")
+	}
+	return nil
+}
+
+// NewInputSource 创建照片来源控件。
+// 传入参数：data 控件的默认值；win 父窗口
+func NewInputSource(data model.InputSourceData, win fyne.Window) *InputSource {
+	t := &InputSource{}
+	t.ExtendBaseWidget(t)
+
+	t.Folder = NewFolderOpenWithEntry(nil, "照片所在文件夹", win)
+	t.Folder.SetEntryText(data.Path)
+
+	t.Label = widget.NewEntry()
+	t.Label.SetPlaceHolder("标签，如手机")
+	t.Label.SetText(data.Label)
+
+	t.ClockOffset = widget.NewEntry()
+	t.ClockOffset.SetPlaceHolder("时差，如-1h")
+	t.ClockOffset.SetText(data.ClockOffset)
+	t.ClockOffset.Validator = validator_offset
+
+	t.SourceContainer = container.New(&InputSourceLayout{}, t.Folder, t.Label, t.ClockOffset)
+
+	return t
+}
+
+func (t *InputSource) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(t.SourceContainer)
+}
+
+// GetInputSourceData 获取照片来源控件的子控件的值，以结构体指针作为返回
+func (t *InputSource) GetInputSourceData() *model.InputSourceData {
+	data := &model.InputSourceData{}
+
+	data.Path = t.Folder.GetEntryText()
+	data.Label = t.Label.Text
+	data.ClockOffset = t.ClockOffset.Text
+
+	return data
+}
+
+// GetValid 获取检查状态。文件夹为空或不存在、时钟偏差格式不合法时返回false
+func (t *InputSource) GetValid() bool {
+	return t.Folder.GetValid() && t.ClockOffset.Validate() == nil
+}
@@ -1,6 +1,7 @@
 package mywidget
 
 import (
+	"MapPhotoMD/internal/model"
 	"errors"
 	"regexp"
 	"time"
@@ -10,52 +11,40 @@ import (
 	"fyne.io/fyne/v2/widget"
 )
 
-// 内置的属性类型
-const (
-	ProType_Tag     = "标签"
-	ProType_Aliases = "别名"
-	ProType_css     = "样式"
-	ProType_Text    = "文本"
-	ProType_List    = "列表"
-	ProType_Num     = "数字"
-	ProType_Check   = "复选框"
-	ProType_Date    = "日期"
-)
-
 // 属性类型与默认属性名称的映射表
 var type2NameMap = map[string]string{
-	ProType_Tag:     "tags",
-	ProType_Aliases: "aliases",
-	ProType_css:     "cssclasses",
-	ProType_Text:    "",
-	ProType_List:    "",
-	ProType_Num:     "",
-	ProType_Check:   "",
-	ProType_Date:    "",
+	model.ProType_Tag:     "tags",
+	model.ProType_Aliases: "aliases",
+	model.ProType_css:     "cssclasses",
+	model.ProType_Text:    "",
+	model.ProType_List:    "",
+	model.ProType_Num:     "",
+	model.ProType_Check:   "",
+	model.ProType_Date:    "",
 }
 
 // 属性类型与属性值提示词的映射表
 var type2PromptMap = map[string]string{
-	ProType_Tag:     "tag1,tag2...",
-	ProType_Aliases: "aliases1,aliases2...",
-	ProType_css:     "css1,css2...",
-	ProType_Text:    "任意文本",
-	ProType_List:    "list1,list2...",
-	ProType_Num:     "只能是数字",
-	ProType_Check:   "true/false",
-	ProType_Date:    "YYYY-MM-DD",
+	model.ProType_Tag:     "tag1,tag2...",
+	model.ProType_Aliases: "aliases1,aliases2...",
+	model.ProType_css:     "css1,css2...",
+	model.ProType_Text:    "任意文本",
+	model.ProType_List:    "list1,list2...",
+	model.ProType_Num:     "只能是数字",
+	model.ProType_Check:   "true/false",
+	model.ProType_Date:    "YYYY-MM-DD",
 }
 
 // 属性类型与属性值文本框检查器的映射表
 var type2ValidatorMap = map[string]func(s string) error{
-	ProType_Tag:     validator_default,
-	ProType_Aliases: validator_default,
-	ProType_css:     validator_default,
-	ProType_Text:    func(s string) error { return nil },
-	ProType_List:    validator_default,
-	ProType_Num:     validator_num,
-	ProType_Check:   validator_bool,
-	ProType_Date:    validator_data,
+	model.ProType_Tag:     validator_default,
+	model.ProType_Aliases: validator_default,
+	model.ProType_css:     validator_default,
+	model.ProType_Text:    func(s string) error { return nil },
+	model.ProType_List:    validator_default,
+	model.ProType_Num:     validator_num,
+	model.ProType_Check:   validator_bool,
+	model.ProType_Date:    validator_data,
 }
 
 type Property struct {
@@ -66,13 +55,6 @@ type Property struct {
 	ProValue     *widget.Entry  //属性值文本框
 }
 
-// PropertyData 属性控件的数据结构体
-type PropertyData struct {
-	Type  string `json:"type"`  //属性类型
-	Name  string `json:"name"`  //属性名称
-	Value string `json:"value"` //属性值
-}
-
 type PropertyLayout struct{}
 
 func (lo *PropertyLayout) MinSize(objects []fyne.CanvasObject) fyne.Size {
@@ -177,8 +159,8 @@ func (t *Property) CreateRenderer() fyne.WidgetRenderer {
 }
 
 // GetPropertyData 获取传入属性控件的子控件的值，以结构体指针作为返回
-func (t *Property) GetPropertyData() *PropertyData {
-	data := &PropertyData{}
+func (t *Property) GetPropertyData() *model.PropertyData {
+	data := &model.PropertyData{}
 
 	data.Name = t.ProName.Text
 	data.Type = t.ProType.Selected